@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kubereboot/kured/pkg/daemonsetlock"
+	flag "github.com/spf13/pflag"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const lockUsage = `Usage: kured lock [flags] <command>
+
+Inspect or release the kured reboot lock, from inside or outside the cluster.
+
+Commands:
+  status               show the nodes holding or waiting for the lock
+  history              show the last lock releases
+  release <node>       remove the lock entry of the given node
+  force-release        remove all the lock entries
+
+Flags:
+`
+
+// runLockCommand implements the `kured lock` admin subcommands.
+func runLockCommand(ctx context.Context, args []string, out io.Writer) error {
+	var kubeconfig, namespace, name, annotation, backend, leaseNamespace, leaseName string
+	var controlPlane bool
+
+	flags := flag.NewFlagSet("lock", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() {
+		fmt.Fprint(out, lockUsage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&kubeconfig, "kubeconfig", "",
+		"path to the kubeconfig file, defaults to $KUBECONFIG, ~/.kube/config, then the in-cluster configuration")
+	flags.StringVar(&namespace, "ds-namespace", "kube-system",
+		"namespace containing daemonset on which to place lock")
+	flags.StringVar(&name, "ds-name", "kured",
+		"name of daemonset on which to place lock")
+	flags.StringVar(&annotation, "lock-annotation", KuredNodeLockAnnotation,
+		"annotation in which to record locking node")
+	flags.StringVar(&backend, "lock-backend", "daemonset",
+		"where the lock is recorded: daemonset (annotation on the kured daemonset) or lease (coordination.k8s.io Leases)")
+	flags.StringVar(&leaseNamespace, "lock-lease-namespace", "kured-lock",
+		"namespace of the Leases holding the lock when --lock-backend=lease")
+	flags.StringVar(&leaseName, "lock-lease-name", "kured",
+		"name prefix of the Leases holding the lock when --lock-backend=lease")
+	flags.BoolVar(&controlPlane, "control-plane", false,
+		"act on the lock of the control plane nodes instead of the lock of the other nodes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing lock command")
+	}
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	switch {
+	case command == "status" && len(commandArgs) == 0:
+	case command == "history" && len(commandArgs) == 0:
+	case command == "release" && len(commandArgs) == 1:
+	case command == "force-release" && len(commandArgs) == 0:
+	default:
+		flags.Usage()
+		return fmt.Errorf("invalid lock command: %v", flags.Args())
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return fmt.Errorf("error loading kubernetes configuration: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+
+	if controlPlane {
+		annotation += controlPlaneLockSuffix
+		leaseName += controlPlaneLockSuffix
+	}
+
+	var admin daemonsetlock.Admin
+	switch backend {
+	case "daemonset":
+		admin = daemonsetlock.NewDaemonSetAdmin(client, namespace, name, annotation)
+	case "lease":
+		admin = daemonsetlock.NewLeaseAdmin(client, leaseNamespace, leaseName, annotation)
+	default:
+		return fmt.Errorf("unknown lock backend %s, valid values are daemonset and lease", backend)
+	}
+
+	switch command {
+	case "status":
+		holders, err := admin.Holders(ctx)
+		if err != nil {
+			return err
+		}
+		waiters, err := admin.Waiters(ctx)
+		if err != nil {
+			return err
+		}
+		return printLockStatus(out, holders, waiters, time.Now())
+	case "history":
+		history, err := admin.History(ctx)
+		if err != nil {
+			return err
+		}
+		return printLockHistory(out, history)
+	case "release":
+		if err := admin.ReleaseNode(ctx, commandArgs[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Released lock held by node %s\n", commandArgs[0])
+	case "force-release":
+		if err := admin.Clear(ctx); errors.Is(err, daemonsetlock.ErrNotHolder) {
+			fmt.Fprintln(out, "Lock is free")
+			return nil
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Released all lock entries")
+	}
+	return nil
+}
+
+// printLockStatus writes the holders and the waiters of the lock as tables.
+func printLockStatus(out io.Writer, holders []daemonsetlock.LockAnnotationValue, waiters []daemonsetlock.Waiter, now time.Time) error {
+	if len(holders) == 0 {
+		fmt.Fprintln(out, "Lock is free")
+	} else {
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NODE\tAGE\tTTL\tLAST RENEWED\tSTATUS")
+		for _, holder := range holders {
+			lastRenewal, renewed := holder.Created, "never"
+			if holder.Renewed.After(holder.Created) {
+				lastRenewal, renewed = holder.Renewed, fmt.Sprintf("%v ago", now.Sub(holder.Renewed).Round(time.Second))
+			}
+			ttl, status := "none", "held"
+			if holder.TTL > 0 {
+				ttl = holder.TTL.String()
+				if remaining := holder.TTL - now.Sub(lastRenewal); remaining > 0 {
+					status = fmt.Sprintf("expires in %v", remaining.Round(time.Second))
+				} else {
+					status = "expired"
+				}
+			}
+			fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\n", holder.NodeID, now.Sub(holder.Created).Round(time.Second), ttl, renewed, status)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(waiters) > 0 {
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "POSITION\tWAITING NODE\tWAITING FOR\tLAST SEEN")
+		for idx, waiter := range waiters {
+			fmt.Fprintf(w, "%d\t%s\t%v\t%v ago\n", idx+1, waiter.NodeID, now.Sub(waiter.Enqueued).Round(time.Second), now.Sub(waiter.LastSeen).Round(time.Second))
+		}
+		return w.Flush()
+	}
+	return nil
+}
+
+// printLockHistory writes the lock releases as a table, most recent first.
+func printLockHistory(out io.Writer, history []daemonsetlock.HistoryEntry) error {
+	if len(history) == 0 {
+		fmt.Fprintln(out, "No lock release recorded")
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NODE\tACQUIRED\tRELEASED\tHELD\tOUTCOME")
+	for i := len(history) - 1; i >= 0; i-- {
+		entry := history[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%s\n", entry.NodeID, entry.Acquired.Format(time.RFC3339), entry.Released.Format(time.RFC3339), entry.Held().Round(time.Second), entry.Outcome)
+	}
+	return w.Flush()
+}
+
+// lockCommandRequested reports whether kured was started as `kured lock ...`.
+func lockCommandRequested() bool {
+	return len(os.Args) > 1 && os.Args[1] == "lock"
+}
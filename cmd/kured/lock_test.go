@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubereboot/kured/pkg/daemonsetlock"
+)
+
+func TestPrintLockStatus(t *testing.T) {
+	now := time.Date(2020, 5, 5, 15, 0, 0, 0, time.UTC)
+
+	out := &bytes.Buffer{}
+	if err := printLockStatus(out, nil, nil, now); err != nil {
+		t.Fatalf("printLockStatus() unexpected error: %v", err)
+	}
+	if out.String() != "Lock is free\n" {
+		t.Errorf("unexpected status for a free lock: %q", out.String())
+	}
+
+	holders := []daemonsetlock.LockAnnotationValue{
+		{NodeID: "n1", Created: now.Add(-10 * time.Minute), TTL: 0},
+		{NodeID: "n2", Created: now.Add(-2 * time.Hour), TTL: time.Hour},
+		{NodeID: "n3", Created: now.Add(-2 * time.Hour), Renewed: now.Add(-5 * time.Minute), TTL: time.Hour},
+	}
+	waiters := []daemonsetlock.Waiter{
+		{NodeID: "n4", Enqueued: now.Add(-time.Hour), LastSeen: now.Add(-time.Minute)},
+	}
+	out.Reset()
+	if err := printLockStatus(out, holders, waiters, now); err != nil {
+		t.Fatalf("printLockStatus() unexpected error: %v", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	expected := []struct {
+		line   int
+		fields []string
+	}{
+		{line: 1, fields: []string{"n1", "10m0s", "none", "never", "held"}},
+		{line: 2, fields: []string{"n2", "2h0m0s", "1h0m0s", "never", "expired"}},
+		{line: 3, fields: []string{"n3", "2h0m0s", "1h0m0s", "5m0s ago", "expires in 55m0s"}},
+		{line: 6, fields: []string{"1", "n4", "1h0m0s", "1m0s ago"}},
+	}
+	for _, e := range expected {
+		for _, field := range e.fields {
+			if !strings.Contains(lines[e.line], field) {
+				t.Errorf("expected %q in line %d of:\n%s", field, e.line, out.String())
+			}
+		}
+	}
+}
+
+func TestRunLockCommandUsage(t *testing.T) {
+	for _, args := range [][]string{{}, {"release"}, {"status", "n1"}, {"unknown"}} {
+		if err := runLockCommand(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("runLockCommand(%v) should fail", args)
+		}
+	}
+}
+
+func TestPrintLockHistory(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := printLockHistory(out, nil); err != nil {
+		t.Fatalf("printLockHistory() unexpected error: %v", err)
+	}
+	if out.String() != "No lock release recorded\n" {
+		t.Errorf("unexpected output for an empty history: %q", out.String())
+	}
+
+	acquired := time.Date(2020, 5, 5, 2, 0, 0, 0, time.UTC)
+	history := []daemonsetlock.HistoryEntry{
+		{NodeID: "n1", Acquired: acquired, Released: acquired.Add(20 * time.Minute), Outcome: daemonsetlock.OutcomeRebooted},
+		{NodeID: "n2", Acquired: acquired.Add(30 * time.Minute), Released: acquired.Add(35 * time.Minute), Outcome: daemonsetlock.OutcomeDrainFailed},
+	}
+	out.Reset()
+	if err := printLockHistory(out, history); err != nil {
+		t.Fatalf("printLockHistory() unexpected error: %v", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if !strings.HasPrefix(lines[1], "n2") || !strings.Contains(lines[1], "5m0s") || !strings.Contains(lines[1], "drain-failed") {
+		t.Errorf("expected the most recent release first, got:\n%s", out.String())
+	}
+	if !strings.HasPrefix(lines[2], "n1") || !strings.Contains(lines[2], "2020-05-05T02:00:00Z") || !strings.Contains(lines[2], "20m0s") {
+		t.Errorf("unexpected history line for n1:\n%s", out.String())
+	}
+}
@@ -6,15 +6,18 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/containrrr/shoutrrr"
@@ -23,7 +26,7 @@ import (
 	"github.com/kubereboot/kured/pkg/checkers"
 	"github.com/kubereboot/kured/pkg/daemonsetlock"
 	"github.com/kubereboot/kured/pkg/delaytick"
-	"github.com/kubereboot/kured/pkg/reboot"
+	"github.com/kubereboot/kured/pkg/nodestatus"
 	"github.com/kubereboot/kured/pkg/taints"
 	"github.com/kubereboot/kured/pkg/timewindow"
 	papi "github.com/prometheus/client_golang/api"
@@ -33,7 +36,10 @@ import (
 	flag "github.com/spf13/pflag"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	kubectldrain "k8s.io/kubectl/pkg/drain"
@@ -57,15 +63,32 @@ var (
 	dsNamespace                     string
 	dsName                          string
 	lockAnnotation                  string
+	lockBackend                     string
+	lockLeaseName                   string
+	lockLeaseNamespace              string
 	lockTTL                         time.Duration
 	lockReleaseDelay                time.Duration
+	lockRenewInterval               time.Duration
+	lockQueue                       bool
+	lockQueueStaleAfter             time.Duration
+	lockHistorySize                 int
 	prometheusURL                   string
 	preferNoScheduleTaintName       string
 	alertFilter                     regexpValue
 	alertFilterMatchOnly            bool
 	alertFiringOnly                 bool
 	rebootSentinelFile              string
+	rebootSentinelPackages          bool
 	rebootSentinelCommand           string
+	rebootSentinelCommandTimeout    time.Duration
+	rebootSentinelCommandMaxOutput  int
+	rebootCheckers                  []string
+	rebootCheckerMode               string
+	rebootRequestedAnnotation       string
+	rebootNodeConditions            []string
+	publishNodeCondition            bool
+	rebootRequiredNodeLabel         string
+	rebootSentinelWatch             bool
 	notifyURL                       string
 	slackHookURL                    string
 	slackUsername                   string
@@ -73,6 +96,9 @@ var (
 	messageTemplateDrain            string
 	messageTemplateReboot           string
 	messageTemplateUncordon         string
+	messageTemplateRebootLoop       string
+	messageTemplateRebootFailed     string
+	messageTemplateRebootEscalation string
 	podSelectors                    []string
 	rebootCommand                   string
 	rebootSignal                    int
@@ -80,7 +106,14 @@ var (
 	preRebootNodeLabels             []string
 	postRebootNodeLabels            []string
 	nodeID                          string
-	concurrency                     int
+	concurrency                     string
+	concurrencyTopologyKey          string
+	concurrencyPerTopology          int
+	controlPlaneNodeLabel           string
+	rebootLoopMaxAttempts           int
+	rebootLoopPeriod                time.Duration
+	rebootDeadline                  time.Duration
+	rebootFallbackMethods           []string
 
 	rebootDays    []string
 	rebootStart   string
@@ -94,6 +127,49 @@ var (
 		Name:      "reboot_required",
 		Help:      "OS requires reboot due to software updates.",
 	}, []string{"node"})
+	rebootCheckFailedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "kured",
+		Name:      "reboot_check_failed",
+		Help:      "Whether the last check of the reboot requirement failed, in which case kured_reboot_required is stale.",
+	}, []string{"node"})
+	lockQueuePositionGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "kured",
+		Name:      "lock_queue_position",
+		Help:      "Position of the node in the reboot lock queue, 0 when not waiting.",
+	}, []string{"node"})
+	lockReleasedGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "kured",
+		Name:      "lock_released_timestamp_seconds",
+		Help:      "Time the node last released the reboot lock, from the lock history.",
+	}, []string{"node", "outcome"})
+	lockHeldGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "kured",
+		Name:      "lock_held_seconds",
+		Help:      "How long the node held the reboot lock the last time, from the lock history.",
+	}, []string{"node", "outcome"})
+	rebootVerificationsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "kured",
+		Name:      "reboot_verifications_total",
+		Help:      "Outcomes of the reboots checked when kured starts while holding the lock: rebooted, interrupted or not-rebooted.",
+	}, []string{"node", "outcome"})
+	rebootTriggersCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "kured",
+		Name:      "reboot_triggers_total",
+		Help:      "Reboots triggered by kured, per reboot method, including the escalations to the fallback methods.",
+	}, []string{"node", "method"})
+	rebootFailuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Subsystem: "kured",
+		Name:      "reboot_failures_total",
+		Help:      "Reboots given up as the node did not reboot within --reboot-deadline with any of the reboot methods.",
+	}, []string{"node"})
+	rebootLoopGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "kured",
+		Name:      "reboot_loop_detected",
+		Help:      "Whether the node still required a reboot after too many reboots, in which case it is not rebooted anymore.",
+	}, []string{"node"})
+
+	// rebootCheckBackoff retries failed reboot checks after 10s, 20s then 40s
+	rebootCheckBackoff = wait.Backoff{Duration: 10 * time.Second, Factor: 2, Steps: 4}
 )
 
 const (
@@ -103,17 +179,43 @@ const (
 	KuredRebootInProgressAnnotation string = "weave.works/kured-reboot-in-progress"
 	// KuredMostRecentRebootNeededAnnotation is the canonical string value for the kured most-recent-reboot-needed annotation
 	KuredMostRecentRebootNeededAnnotation string = "weave.works/kured-most-recent-reboot-needed"
+	// KuredMostRecentRebootNeededPackagesAnnotation is the canonical string value for the kured most-recent-reboot-needed-packages annotation
+	KuredMostRecentRebootNeededPackagesAnnotation string = "weave.works/kured-most-recent-reboot-needed-packages"
+	// KuredRebootReasonAnnotation is the canonical string value for the kured reboot-reason annotation
+	KuredRebootReasonAnnotation string = "weave.works/kured-reboot-reason"
+	// KuredRebootAttemptsAnnotation is the canonical string value for the kured reboot-attempts annotation
+	KuredRebootAttemptsAnnotation string = "weave.works/kured-reboot-attempts"
 	// EnvPrefix The environment variable prefix of all environment variables bound to our command line flags.
 	EnvPrefix = "KURED"
+	// controlPlaneLockSuffix is appended to the lock annotation and lease name for the lock of the control plane nodes
+	controlPlaneLockSuffix = "-control-plane"
 
 	sigTrminPlus5 = 34 + 5
 )
 
 func init() {
 	prometheus.MustRegister(rebootRequiredGauge)
+	prometheus.MustRegister(rebootCheckFailedGauge)
+	prometheus.MustRegister(lockQueuePositionGauge)
+	prometheus.MustRegister(lockReleasedGauge)
+	prometheus.MustRegister(lockHeldGauge)
+	prometheus.MustRegister(rebootLoopGauge)
+	prometheus.MustRegister(rebootVerificationsCounter)
+	prometheus.MustRegister(rebootTriggersCounter)
+	prometheus.MustRegister(rebootFailuresCounter)
 }
 
 func main() {
+	// Lock operations in progress are cancelled on termination
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if lockCommandRequested() {
+		if err := runLockCommand(ctx, os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	flag.StringVar(&nodeID, "node-id", "",
 		"node name kured runs on, should be passed down from spec.nodeName via KURED_NODE_ID environment variable")
@@ -136,7 +238,7 @@ func main() {
 	flag.DurationVar(&rebootDelay, "reboot-delay", 0,
 		"delay reboot for this duration (default: 0, disabled)")
 	flag.StringVar(&rebootMethod, "reboot-method", "command",
-		"method to use for reboots. Available: command")
+		"method to use for reboots. Available: command, signal, sysrq")
 	flag.DurationVar(&period, "period", time.Minute*60,
 		"sentinel check period")
 	flag.StringVar(&dsNamespace, "ds-namespace", "kube-system",
@@ -145,10 +247,24 @@ func main() {
 		"name of daemonset on which to place lock")
 	flag.StringVar(&lockAnnotation, "lock-annotation", KuredNodeLockAnnotation,
 		"annotation in which to record locking node")
+	flag.StringVar(&lockBackend, "lock-backend", "daemonset",
+		"storage backend of the reboot lock. Available: daemonset, lease (requires the permissions of kured-rbac-lease.yaml)")
+	flag.StringVar(&lockLeaseName, "lock-lease-name", "kured",
+		"name prefix of the leases holding the lock when using the lease lock backend")
+	flag.StringVar(&lockLeaseNamespace, "lock-lease-namespace", "kured-lock",
+		"namespace of the leases holding the lock when using the lease lock backend, dedicated to them (see kured-rbac-lease.yaml)")
 	flag.DurationVar(&lockTTL, "lock-ttl", 0,
 		"expire lock annotation after this duration (default: 0, disabled)")
 	flag.DurationVar(&lockReleaseDelay, "lock-release-delay", 0,
 		"delay lock release for this duration (default: 0, disabled)")
+	flag.DurationVar(&lockRenewInterval, "lock-renew-interval", 0,
+		"renew the held lock at this interval while draining and rebooting, so that --lock-ttl only expires locks of dead or stuck nodes (default: 0, a third of --lock-ttl)")
+	flag.BoolVar(&lockQueue, "lock-queue", false,
+		"grant the lock to the nodes in the order they started waiting for it, skipping the nodes whose topology domain already reached --concurrency-per-topology")
+	flag.DurationVar(&lockQueueStaleAfter, "lock-queue-stale-after", 0,
+		"remove nodes from the lock queue when they did not try to acquire the lock for this duration (default: 0, three times --period)")
+	flag.IntVar(&lockHistorySize, "lock-history-size", daemonsetlock.DefaultHistorySize,
+		"amount of lock releases kept in the lock history, stored next to the lock (<lock-annotation>-history annotation or <lock-lease-name>-history Lease), 0 disables the history")
 	flag.StringVar(&prometheusURL, "prometheus-url", "",
 		"Prometheus instance to probe for active alerts")
 	flag.Var(&alertFilter, "alert-filter-regexp",
@@ -159,14 +275,48 @@ func main() {
 		"only consider firing alerts when checking for active alerts")
 	flag.StringVar(&rebootSentinelFile, "reboot-sentinel", "/var/run/reboot-required",
 		"path to file whose existence triggers the reboot command")
+	flag.BoolVar(&rebootSentinelPackages, "reboot-sentinel-packages", false,
+		"report the packages requiring the reboot, read from the file next to the reboot sentinel files suffixed with "+checkers.PackagesSuffix+" (e.g. /var/run/reboot-required.pkgs on Debian and Ubuntu)")
 	flag.StringVar(&preferNoScheduleTaintName, "prefer-no-schedule-taint", "",
 		"Taint name applied during pending node reboot (to prevent receiving additional pods from other rebooting nodes). Disabled by default. Set e.g. to \"weave.works/kured-node-reboot\" to enable tainting.")
 	flag.StringVar(&rebootSentinelCommand, "reboot-sentinel-command", "",
 		"command for which a zero return code will trigger a reboot command")
+	flag.DurationVar(&rebootSentinelCommandTimeout, "reboot-sentinel-command-timeout", checkers.DefaultCommandTimeout,
+		"kill the sentinel commands, and the processes they started, when they do not complete within this duration, failing the check (0: disabled)")
+	flag.IntVar(&rebootSentinelCommandMaxOutput, "reboot-sentinel-command-max-output", checkers.DefaultCommandMaxOutput,
+		"amount of bytes of the stdout and stderr of the sentinel commands kept for the logs, each (0: unlimited)")
+	flag.StringArrayVar(&rebootCheckers, "reboot-checker", nil,
+		"reboot checker, as [name=]type:argument with type file (path whose existence requires a reboot) or command (command whose zero return code requires a reboot) or rpm-ostree (path of rpm-ostree on the host, whose staged deployment requires a reboot) or transactional-update (path of snapper on the host, whose new default snapshot requires a reboot) or kernel (host root filesystem, e.g. /proc/1/root, in which a kernel newer than the running one requires a reboot) or uptime (maximum uptime, e.g. 720h, above which a reboot is required). Repeat to use several checkers, which replace --reboot-sentinel and --reboot-sentinel-command")
+	flag.StringVar(&rebootCheckerMode, "reboot-checker-mode", checkers.ModeAny,
+		"when several --reboot-checker are given, reboot when any or all of them require it")
+	flag.BoolVar(&rebootSentinelWatch, "reboot-sentinel-watch", false,
+		"watch the directories of the reboot sentinel files with inotify, to check if a reboot is required as soon as they appear or disappear instead of only every --period")
+	flag.StringVar(&rebootRequestedAnnotation, "reboot-requested-annotation", "",
+		"node annotation (e.g. kured.dev/reboot-requested=<RFC3339 timestamp>) requesting a reboot on top of the reboot checkers, removed once kured rebooted the node (default: '', disabled)")
+	flag.StringSliceVar(&rebootNodeConditions, "reboot-node-condition", nil,
+		"node conditions, as Type or Type=Status (default status: True), requiring a reboot on top of the reboot checkers, e.g. KernelDeadlock set by node-problem-detector (default: '', disabled)")
+	flag.BoolVar(&publishNodeCondition, "publish-node-condition", false,
+		"publish the result of the reboot checks on the node as the "+string(nodestatus.ConditionType)+" condition")
+	flag.StringVar(&rebootRequiredNodeLabel, "reboot-required-node-label", "",
+		"node label (e.g. kured.dev/reboot-required) set to true while a reboot is required, and removed otherwise (default: '', disabled)")
 	flag.StringVar(&rebootCommand, "reboot-command", "/bin/systemctl reboot",
 		"command to run when a reboot is required")
-	flag.IntVar(&concurrency, "concurrency", 1,
-		"amount of nodes to concurrently reboot. Defaults to 1")
+	flag.StringVar(&concurrency, "concurrency", "1",
+		"amount of nodes to concurrently reboot, or percentage of the nodes running kured (e.g. 10%, rounded down, at least 1). Defaults to 1")
+	flag.StringVar(&concurrencyTopologyKey, "concurrency-topology-key", "",
+		"node label key defining topology domains (e.g. topology.kubernetes.io/zone) in which at most --concurrency-per-topology nodes reboot concurrently (default: '', disabled)")
+	flag.StringVar(&controlPlaneNodeLabel, "control-plane-node-label", "",
+		"label selector matching the control plane nodes (e.g. node-role.kubernetes.io/control-plane), which reboot one at a time through a lock of their own. A control plane node can then reboot at the same time as the other nodes, on top of --concurrency (default: '', disabled)")
+	flag.IntVar(&concurrencyPerTopology, "concurrency-per-topology", 1,
+		"amount of nodes of the same topology domain to concurrently reboot, when --concurrency-topology-key is set")
+	flag.IntVar(&rebootLoopMaxAttempts, "reboot-loop-max-attempts", 0,
+		"stop rebooting a node which still requires a reboot after this amount of reboots within --reboot-loop-period, e.g. because a package hook keeps recreating the reboot sentinel (default: 0, disabled)")
+	flag.DurationVar(&rebootLoopPeriod, "reboot-loop-period", 24*time.Hour,
+		"period in which the reboots are counted by --reboot-loop-max-attempts")
+	flag.DurationVar(&rebootDeadline, "reboot-deadline", 10*time.Minute,
+		"time given to the node to reboot once the reboot is triggered, after which the reboot is escalated to the next --reboot-fallback-methods, or given up after the last of them: kured then exits, and releases the lock once it restarted. Without fallback methods, kured waits for the reboot forever, and only uses it to tell on restart whether the reboot failed (0: wait forever)")
+	flag.StringSliceVar(&rebootFallbackMethods, "reboot-fallback-methods", nil,
+		"reboot methods tried in turn when the node did not reboot within --reboot-deadline, e.g. signal,sysrq. The sysrq method forces an immediate reboot without shutting down the services (default: '', none)")
 	flag.IntVar(&rebootSignal, "reboot-signal", sigTrminPlus5,
 		"signal to use for reboot, SIGRTMIN+5 by default.")
 	flag.StringVar(&slackHookURL, "slack-hook-url", "",
@@ -183,6 +333,12 @@ func main() {
 		"message template used to notify about a node being drained")
 	flag.StringVar(&messageTemplateReboot, "message-template-reboot", "Rebooting node %s",
 		"message template used to notify about a node being rebooted")
+	flag.StringVar(&messageTemplateRebootLoop, "message-template-reboot-loop", "Node %s still requires a reboot after rebooting, it will not be rebooted anymore",
+		"message template used to notify about a node not being rebooted anymore because of a reboot loop")
+	flag.StringVar(&messageTemplateRebootFailed, "message-template-reboot-failed", "Node %s did not reboot",
+		"message template used to notify about a node which did not reboot after triggering its reboot")
+	flag.StringVar(&messageTemplateRebootEscalation, "message-template-reboot-escalation", "Node %s did not reboot, escalating the reboot",
+		"message template used to notify about a node being rebooted with the next fallback method")
 	flag.StringArrayVar(&podSelectors, "blocking-pod-selector", nil,
 		"label selector identifying pods whose presence should prevent reboots")
 	flag.StringSliceVar(&rebootDays, "reboot-days", timewindow.EveryDay,
@@ -194,7 +350,7 @@ func main() {
 	flag.StringVar(&timezone, "time-zone", "UTC",
 		"use this timezone for schedule inputs")
 	flag.BoolVar(&annotateNodes, "annotate-nodes", false,
-		"if set, the annotations 'weave.works/kured-reboot-in-progress' and 'weave.works/kured-most-recent-reboot-needed' will be given to nodes undergoing kured reboots")
+		"if set, the annotations 'weave.works/kured-reboot-in-progress', 'weave.works/kured-most-recent-reboot-needed', 'weave.works/kured-most-recent-reboot-needed-packages' and 'weave.works/kured-reboot-reason' will be given to nodes undergoing kured reboots")
 	flag.StringVar(&logFormat, "log-format", "text",
 		"use text or json log format")
 	flag.StringSliceVar(&preRebootNodeLabels, "pre-reboot-node-labels", nil,
@@ -231,11 +387,34 @@ func main() {
 	log.Infof("Blocking Pod Selectors: %v", podSelectors)
 
 	log.Infof("Reboot period %v", period)
-	log.Infof("Concurrency: %v", concurrency)
+	maxConcurrency, err := daemonsetlock.ParseConcurrency(concurrency)
+	if err != nil {
+		log.Fatalf("Failed to parse concurrency: %v", err)
+	}
+	log.Infof("Concurrency: %v", maxConcurrency.String())
+	var lockOptions []daemonsetlock.Option
+	if concurrencyTopologyKey != "" {
+		log.Infof("Concurrency per %s: %v", concurrencyTopologyKey, concurrencyPerTopology)
+		lockOptions = append(lockOptions, daemonsetlock.WithTopologyLimit(concurrencyPerTopology))
+	}
+	if lockQueue {
+		if lockQueueStaleAfter <= 0 {
+			lockQueueStaleAfter = 3 * period
+		}
+		log.Infof("Lock queue enabled, waiting nodes are forgotten after: %v", lockQueueStaleAfter)
+		lockOptions = append(lockOptions, daemonsetlock.WithQueue(lockQueueStaleAfter))
+	}
+	if lockHistorySize > 0 {
+		log.Infof("Lock history keeps the last %d lock releases", lockHistorySize)
+		lockOptions = append(lockOptions, daemonsetlock.WithHistory(lockHistorySize))
+	}
 
 	if annotateNodes {
 		log.Infof("Will annotate nodes during kured reboot operations")
 	}
+	if rebootLoopMaxAttempts > 0 {
+		log.Infof("Reboot loop protection: nodes are not rebooted anymore after %d reboots within %v", rebootLoopMaxAttempts, rebootLoopPeriod)
+	}
 
 	// Now call the rest of the main loop.
 	window, err := timewindow.New(rebootDays, rebootStart, rebootEnd, timezone)
@@ -245,14 +424,12 @@ func main() {
 	log.Infof("Reboot schedule: %v", window)
 
 	log.Infof("Reboot method: %s", rebootMethod)
-	rebooter, err := internal.NewRebooter(rebootMethod, rebootCommand, rebootSignal)
-	if err != nil {
-		log.Fatalf("Failed to build rebooter: %v", err)
+	if len(rebootFallbackMethods) > 0 {
+		log.Infof("Reboot fallback methods, tried in turn every %v: %s", rebootDeadline, strings.Join(rebootFallbackMethods, ", "))
 	}
-
-	rebootChecker, err := internal.NewRebootChecker(rebootSentinelCommand, rebootSentinelFile)
+	rebootMethods, err := newRebootMethods(rebootMethod, rebootFallbackMethods)
 	if err != nil {
-		log.Fatalf("Failed to build reboot checker: %v", err)
+		log.Fatalf("Failed to build rebooter: %v", err)
 	}
 
 	config, err := rest.InClusterConfig()
@@ -265,6 +442,35 @@ func main() {
 		log.Fatal(err)
 	}
 
+	rebootChecker, err := internal.NewRebootChecker(rebootCheckers, rebootCheckerMode, rebootSentinelCommand, rebootSentinelFile, rebootSentinelPackages,
+		checkers.WithCommandTimeout(rebootSentinelCommandTimeout), checkers.WithCommandMaxOutput(rebootSentinelCommandMaxOutput))
+	if err != nil {
+		log.Fatalf("Failed to build reboot checker: %v", err)
+	}
+	nodeCheckers := []checkers.NamedChecker{{Name: "checker", Checker: rebootChecker}}
+	if rebootRequestedAnnotation != "" {
+		log.Infof("Reboots can be requested with the node annotation: %s", rebootRequestedAnnotation)
+		nodeCheckers = append(nodeCheckers, checkers.NamedChecker{Name: "request", Checker: checkers.NewNodeAnnotationChecker(client, nodeID, rebootRequestedAnnotation)})
+	}
+	if len(rebootNodeConditions) > 0 {
+		conditions, err := checkers.ParseNodeConditions(rebootNodeConditions)
+		if err != nil {
+			log.Fatalf("Failed to parse reboot node conditions: %v", err)
+		}
+		conditionChecker, err := checkers.NewNodeConditionChecker(client, nodeID, conditions)
+		if err != nil {
+			log.Fatalf("Failed to build reboot checker: %v", err)
+		}
+		log.Infof("Reboots are required by the node conditions: %s", strings.Join(rebootNodeConditions, ", "))
+		nodeCheckers = append(nodeCheckers, checkers.NamedChecker{Name: "condition", Checker: conditionChecker})
+	}
+	if len(nodeCheckers) > 1 {
+		rebootChecker, err = checkers.NewCompositeChecker(checkers.ModeAny, nodeCheckers...)
+		if err != nil {
+			log.Fatalf("Failed to build reboot checker: %v", err)
+		}
+	}
+
 	var blockCheckers []blockers.RebootBlocker
 	if prometheusURL != "" {
 		blockCheckers = append(blockCheckers, blockers.NewPrometheusBlockingChecker(papi.Config{Address: prometheusURL}, alertFilter.Regexp, alertFiringOnly, alertFilterMatchOnly))
@@ -272,9 +478,15 @@ func main() {
 	if podSelectors != nil {
 		blockCheckers = append(blockCheckers, blockers.NewKubernetesBlockingChecker(client, nodeID, podSelectors))
 	}
-	log.Infof("Lock Annotation: %s/%s:%s", dsNamespace, dsName, lockAnnotation)
 	if lockTTL > 0 {
 		log.Infof("Lock TTL set, lock will expire after: %v", lockTTL)
+		if lockRenewInterval <= 0 {
+			lockRenewInterval = lockTTL / 3
+		}
+		if lockRenewInterval >= lockTTL {
+			log.Warnf("Lock renew interval %v is not shorter than the lock TTL %v, lock might expire while being held", lockRenewInterval, lockTTL)
+		}
+		log.Infof("Lock will be renewed every: %v", lockRenewInterval)
 	} else {
 		log.Info("Lock TTL not set, lock will remain until being released")
 	}
@@ -283,13 +495,48 @@ func main() {
 	} else {
 		log.Info("Lock release delay not set, lock will be released immediately after rebooting")
 	}
-	lock := daemonsetlock.New(client, nodeID, dsNamespace, dsName, lockAnnotation, lockTTL, concurrency, lockReleaseDelay)
+	if controlPlaneNodeLabel != "" {
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeID, metav1.GetOptions{})
+		if err != nil {
+			log.Fatalf("Error retrieving node object via k8s API: %v", err)
+		}
+		controlPlane, err := isControlPlaneNode(node.Labels, controlPlaneNodeLabel)
+		if err != nil {
+			log.Fatalf("Invalid control-plane-node-label %s: %v", controlPlaneNodeLabel, err)
+		}
+		if controlPlane {
+			log.Infof("Node matches %s, control plane nodes reboot one at a time", controlPlaneNodeLabel)
+			lockAnnotation += controlPlaneLockSuffix
+			lockLeaseName += controlPlaneLockSuffix
+			maxConcurrency = intstr.FromInt32(1)
+		}
+	}
+	var lock daemonsetlock.Lock
+	switch lockBackend {
+	case "daemonset":
+		log.Infof("Lock Annotation: %s/%s:%s", dsNamespace, dsName, lockAnnotation)
+		lock = daemonsetlock.New(client, nodeID, dsNamespace, dsName, lockAnnotation, lockTTL, maxConcurrency, lockReleaseDelay, lockOptions...)
+	case "lease":
+		log.Infof("Lock Leases: %s/%s-<slot>", lockLeaseNamespace, lockLeaseName)
+		lock = daemonsetlock.NewLeaseLock(client, nodeID, dsNamespace, dsName, lockLeaseNamespace, lockLeaseName, lockAnnotation, lockTTL, maxConcurrency, lockReleaseDelay, lockOptions...)
+	default:
+		log.Fatalf("Invalid lock-backend configured %s, expected daemonset or lease", lockBackend)
+	}
 
-	go rebootAsRequired(nodeID, rebooter, rebootChecker, blockCheckers, window, lock, client)
-	go maintainRebootRequiredMetric(nodeID, rebootChecker)
+	go rebootAsRequired(ctx, nodeID, rebootMethods, rebootChecker, blockCheckers, window, lock, client)
+	publisher := nodestatus.New(client, nodeID, publishNodeCondition, rebootRequiredNodeLabel)
+	if publisher.Enabled() {
+		log.Infof("Will publish the reboot checks on the node (condition: %v, label: %s)", publishNodeCondition, rebootRequiredNodeLabel)
+	}
+	go maintainRebootRequiredMetric(ctx, nodeID, rebootChecker, publisher)
 
 	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(fmt.Sprintf("%s:%d", metricsHost, metricsPort), nil)) // #nosec G114
+	go func() {
+		log.Fatal(http.ListenAndServe(fmt.Sprintf("%s:%d", metricsHost, metricsPort), nil)) // #nosec G114
+	}()
+
+	<-ctx.Done()
+	log.Info("Received termination signal, exiting")
 }
 
 func validateNodeLabels(preRebootNodeLabels []string, postRebootNodeLabels []string) error {
@@ -415,7 +662,7 @@ func stripQuotes(str string) string {
 	return str
 }
 
-func drain(client *kubernetes.Clientset, node *v1.Node) error {
+func drain(client *kubernetes.Clientset, node *v1.Node, reason string) error {
 	nodename := node.GetName()
 
 	if preRebootNodeLabels != nil {
@@ -430,7 +677,7 @@ func drain(client *kubernetes.Clientset, node *v1.Node) error {
 	log.Infof("Draining node %s", nodename)
 
 	if notifyURL != "" {
-		if err := shoutrrr.Send(notifyURL, fmt.Sprintf(messageTemplateDrain, nodename)); err != nil {
+		if err := shoutrrr.Send(notifyURL, withReason(fmt.Sprintf(messageTemplateDrain, nodename), reason)); err != nil {
 			log.Warnf("Error notifying: %v", err)
 		}
 	}
@@ -479,17 +726,85 @@ func uncordon(client *kubernetes.Clientset, node *v1.Node) error {
 	return nil
 }
 
-func maintainRebootRequiredMetric(nodeID string, checker checkers.Checker) {
+// maintainRebootRequiredMetric exposes the result of the reboot checks in the metrics,
+// and publishes it on the node.
+func maintainRebootRequiredMetric(ctx context.Context, nodeID string, checker checkers.Checker, publisher *nodestatus.Publisher) {
 	for {
-		if checker.RebootRequired() {
-			rebootRequiredGauge.WithLabelValues(nodeID).Set(1)
+		result, err := checker.RebootRequired()
+		if err != nil {
+			// A failed check tells nothing about the reboot requirement: its previous value is kept
+			log.Warnf("Unable to check if a reboot is required: %v", err)
+			rebootCheckFailedGauge.WithLabelValues(nodeID).Set(1)
 		} else {
-			rebootRequiredGauge.WithLabelValues(nodeID).Set(0)
+			rebootCheckFailedGauge.WithLabelValues(nodeID).Set(0)
+			if result.Required {
+				rebootRequiredGauge.WithLabelValues(nodeID).Set(1)
+			} else {
+				rebootRequiredGauge.WithLabelValues(nodeID).Set(0)
+			}
+		}
+		if err := publisher.Publish(ctx, result, err, describeRebootReason(result)); err != nil {
+			log.Warnf("Unable to publish the reboot check on the node: %v", err)
 		}
 		time.Sleep(time.Minute)
 	}
 }
 
+// checkRebootRequired runs the reboot checker, retrying the failed checks with rebootCheckBackoff.
+func checkRebootRequired(ctx context.Context, checker checkers.Checker) (checkers.Result, error) {
+	var result checkers.Result
+	var checkErr error
+	err := wait.ExponentialBackoffWithContext(ctx, rebootCheckBackoff, func(context.Context) (bool, error) {
+		result, checkErr = checker.RebootRequired()
+		if checkErr != nil {
+			log.Warnf("Reboot check failed: %v", checkErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if checkErr != nil {
+		return checkers.Result{}, checkErr
+	}
+	return result, err
+}
+
+// watchRebootChecker returns the channel notifying the changes of the reboot sentinels when
+// --reboot-sentinel-watch is set and they can be watched. The returned channel is nil otherwise,
+// leaving only the periodic checks.
+func watchRebootChecker(ctx context.Context, checker checkers.Checker) <-chan struct{} {
+	if !rebootSentinelWatch {
+		return nil
+	}
+	watcher, ok := checker.(checkers.Watcher)
+	if !ok {
+		log.Warnf("Reboot checker cannot be watched, it will only be checked every %v", period)
+		return nil
+	}
+	changes, err := watcher.Watch(ctx)
+	if err != nil {
+		log.Warnf("Unable to watch reboot sentinels, they will only be checked every %v: %v", period, err)
+		return nil
+	}
+	log.Infof("Watching reboot sentinels")
+	return changes
+}
+
+// describeRebootReason returns the reason of the reboot check result, followed by its details.
+func describeRebootReason(result checkers.Result) string {
+	if len(result.Details) == 0 {
+		return result.Reason
+	}
+	return fmt.Sprintf("%s (%s)", result.Reason, strings.Join(result.Details, ", "))
+}
+
+// withReason appends the reboot reason, when known, to a notification message.
+func withReason(message, reason string) string {
+	if reason == "" {
+		return message
+	}
+	return fmt.Sprintf("%s: %s", message, reason)
+}
+
 func addNodeAnnotations(client *kubernetes.Clientset, nodeID string, annotations map[string]string) error {
 	node, err := client.CoreV1().Nodes().Get(context.TODO(), nodeID, metav1.GetOptions{})
 	if err != nil {
@@ -564,22 +879,118 @@ func updateNodeLabels(client *kubernetes.Clientset, node *v1.Node, labels []stri
 	}
 }
 
-func rebootAsRequired(nodeID string, rebooter reboot.Rebooter, checker checkers.Checker, blockCheckers []blockers.RebootBlocker, window *timewindow.TimeWindow, lock daemonsetlock.Lock, client *kubernetes.Clientset) {
+// startLockHeartbeat keeps renewing the lock held by this node when it can expire,
+// and returns the function to call to stop renewing it.
+func startLockHeartbeat(ctx context.Context, lock daemonsetlock.Lock) func() {
+	if lockRenewInterval <= 0 {
+		return func() {}
+	}
+	return daemonsetlock.Heartbeat(ctx, lock, lockRenewInterval)
+}
+
+// leaveLockQueue removes this node from the lock queue when it stops waiting for the lock,
+// so that it does not hold back the nodes queued behind it.
+func leaveLockQueue(ctx context.Context, lock daemonsetlock.Lock, nodeID string) {
+	if err := lock.Dequeue(ctx); err != nil {
+		log.Warnf("Error leaving lock queue: %v", err)
+	}
+	lockQueuePositionGauge.WithLabelValues(nodeID).Set(float64(lock.QueuePosition()))
+}
+
+// isControlPlaneNode reports whether the node labels match the control plane label selector.
+func isControlPlaneNode(nodeLabels map[string]string, selector string) (bool, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return false, err
+	}
+	return parsed.Matches(labels.Set(nodeLabels)), nil
+}
+
+// rebootRequestFulfilled reports whether a reboot requested through the node annotation with the
+// given value was fulfilled by the reboot for which the lock was acquired at lockAcquired.
+// Values which are not RFC3339 timestamps cannot be dated, so they are always fulfilled.
+func rebootRequestFulfilled(requested string, lockAcquired time.Time) bool {
+	requestTime, err := time.Parse(time.RFC3339, requested)
+	if err != nil || lockAcquired.IsZero() {
+		return true
+	}
+	return requestTime.Before(lockAcquired)
+}
+
+// updateLockHistoryMetrics exposes the last lock release of this node recorded in the lock history.
+func updateLockHistoryMetrics(ctx context.Context, lock daemonsetlock.Lock) {
+	if lockHistorySize <= 0 {
+		return
+	}
+	history, err := lock.History(ctx)
+	if err != nil {
+		log.Warnf("Error reading lock history: %v", err)
+		return
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if entry := history[i]; entry.NodeID == nodeID {
+			lockReleasedGauge.Reset()
+			lockHeldGauge.Reset()
+			lockReleasedGauge.WithLabelValues(nodeID, entry.Outcome).Set(float64(entry.Released.Unix()))
+			lockHeldGauge.WithLabelValues(nodeID, entry.Outcome).Set(entry.Held().Seconds())
+			return
+		}
+	}
+}
+
+func rebootAsRequired(ctx context.Context, nodeID string, rebootMethods []namedRebooter, checker checkers.Checker, blockCheckers []blockers.RebootBlocker, window *timewindow.TimeWindow, lock daemonsetlock.Lock, client *kubernetes.Clientset) {
 
 	source := rand.NewSource(time.Now().UnixNano())
 	tick := delaytick.New(source, 1*time.Minute)
+	var stopHeartbeat func()
+	var verification string
 	for range tick {
-		holding, lockData, err := lock.Holding()
+		holding, lockData, err := lock.Holding(ctx)
 		if err != nil {
 			log.Errorf("Error testing lock: %v", err)
 		}
 		if holding {
+			if stopHeartbeat == nil {
+				stopHeartbeat = startLockHeartbeat(ctx, lock)
+			}
+
 			node, err := client.CoreV1().Nodes().Get(context.TODO(), nodeID, metav1.GetOptions{})
 			if err != nil {
 				log.Errorf("Error retrieving node object via k8s API: %v", err)
 				continue
 			}
 
+			// Holding the lock does not mean that the node rebooted: the boot ID tells
+			// whether it did, or whether kured merely restarted
+			if verification == "" || verification == rebootPending {
+				var attempt rebootAttempt
+				bootID, err := readBootID(bootIDPath)
+				if err != nil {
+					log.Warnf("Unable to verify the reboot, assuming it happened: %v", err)
+					verification = rebootVerified
+				} else {
+					verification, attempt = verifyReboot(node, bootID, lockData.Created, time.Now())
+				}
+				switch verification {
+				case rebootPending:
+					log.Infof("Reboot triggered at %v is in progress, waiting for the node to reboot", attempt.Time)
+					continue
+				case rebootInterrupted:
+					log.Warnf("Reboot was not triggered before kured restarted, releasing lock to check again if a reboot is required")
+				case rebootNotHappened:
+					log.Errorf("Node did not reboot since the reboot was triggered at %v, releasing lock", attempt.Time)
+					rebootFailuresCounter.WithLabelValues(nodeID).Inc()
+					if notifyURL != "" {
+						if err := shoutrrr.Send(notifyURL, fmt.Sprintf(messageTemplateRebootFailed, nodeID)); err != nil {
+							log.Warnf("Error notifying: %v", err)
+						}
+					}
+				default:
+					log.Infof("Node rebooted")
+				}
+				rebootVerificationsCounter.WithLabelValues(nodeID, verification).Inc()
+			}
+
 			if !lockData.Metadata.Unschedulable {
 				err = uncordon(client, node)
 				if err != nil {
@@ -587,54 +998,129 @@ func rebootAsRequired(nodeID string, rebooter reboot.Rebooter, checker checkers.
 					continue
 				}
 
-				if notifyURL != "" {
+				if notifyURL != "" && verification == rebootVerified {
 					if err := shoutrrr.Send(notifyURL, fmt.Sprintf(messageTemplateUncordon, nodeID)); err != nil {
 						log.Warnf("Error notifying: %v", err)
 					}
 				}
 			}
+
+			if verification != rebootVerified {
+				err = lock.Release(ctx, releaseOutcome(verification))
+				if err != nil && !errors.Is(err, daemonsetlock.ErrNotHolder) {
+					log.Errorf("Error releasing lock, will retry: %v", err)
+					continue
+				}
+				if err == nil {
+					updateLockHistoryMetrics(ctx, lock)
+				}
+				break
+			}
+
+			// Reboot requests made before this node acquired the lock are fulfilled by the reboot
+			if requested, ok := node.Annotations[rebootRequestedAnnotation]; ok && rebootRequestedAnnotation != "" && rebootRequestFulfilled(requested, lockData.Created) {
+				err := deleteNodeAnnotation(client, nodeID, rebootRequestedAnnotation)
+				if err != nil {
+					continue
+				}
+			}
+
 			// If we're holding the lock we know we've tried, in a prior run, to reboot
 			// So (1) we want to confirm that the reboot succeeded practically ( !rebootRequired() )
 			// And (2) check if we previously annotated the node that it was in the process of being rebooted,
 			// And finally (3) if it has that annotation, to delete it.
 			// This indicates to other node tools running on the cluster that this node may be a candidate for maintenance
-			if annotateNodes && !checker.RebootRequired() {
-				if _, ok := node.Annotations[KuredRebootInProgressAnnotation]; ok {
-					err := deleteNodeAnnotation(client, nodeID, KuredRebootInProgressAnnotation)
-					if err != nil {
-						continue
+			// The reboot attempts are only counted while the reboots do not succeed, so they are also deleted.
+			if annotateNodes || rebootLoopMaxAttempts > 0 {
+				result, err := checkRebootRequired(ctx, checker)
+				if err != nil {
+					log.Warnf("Unable to confirm the reboot succeeded, keeping node annotations: %v", err)
+				} else if !result.Required {
+					if _, ok := node.Annotations[KuredRebootInProgressAnnotation]; ok && annotateNodes {
+						err := deleteNodeAnnotation(client, nodeID, KuredRebootInProgressAnnotation)
+						if err != nil {
+							continue
+						}
+					}
+					if _, ok := node.Annotations[KuredRebootReasonAnnotation]; ok && annotateNodes {
+						err := deleteNodeAnnotation(client, nodeID, KuredRebootReasonAnnotation)
+						if err != nil {
+							continue
+						}
+					}
+					if _, ok := node.Annotations[KuredRebootAttemptsAnnotation]; ok {
+						err := deleteNodeAnnotation(client, nodeID, KuredRebootAttemptsAnnotation)
+						if err != nil {
+							continue
+						}
 					}
+				} else if rebootLoopMaxAttempts > 0 {
+					attempts := nodeRebootAttempts(node, time.Now())
+					log.Warnf("Reboot still required after rebooting (%d of %d reboots within %v): %s", len(attempts), rebootLoopMaxAttempts, rebootLoopPeriod, describeRebootReason(result))
 				}
 			}
 
-			err = lock.Release()
-			if err != nil {
+			err = lock.Release(ctx, daemonsetlock.OutcomeRebooted)
+			if errors.Is(err, daemonsetlock.ErrNotHolder) {
+				log.Warnf("Lock no longer held, skipping release: %v", err)
+			} else if err != nil {
 				log.Errorf("Error releasing lock, will retry: %v", err)
 				continue
+			} else {
+				updateLockHistoryMetrics(ctx, lock)
 			}
 		}
 		break
 	}
+	if stopHeartbeat != nil {
+		stopHeartbeat()
+	}
 
 	preferNoScheduleTaint := taints.New(client, nodeID, preferNoScheduleTaintName, v1.TaintEffectPreferNoSchedule)
 
 	// Remove taint immediately during startup to quickly allow scheduling again.
-	if !checker.RebootRequired() {
+	if result, err := checkRebootRequired(ctx, checker); err != nil {
+		log.Errorf("Unable to check if a reboot is required: %v", err)
+	} else if !result.Required {
 		preferNoScheduleTaint.Disable()
 	}
 
+	sentinelChanges := watchRebootChecker(ctx, checker)
+	// rebootLoopNotified avoids notifying about the same reboot loop every period
+	rebootLoopNotified := false
+
 	source = rand.NewSource(time.Now().UnixNano())
 	tick = delaytick.New(source, period)
-	for range tick {
+	for {
+		select {
+		case <-tick:
+		case _, ok := <-sentinelChanges:
+			if !ok {
+				// The watch ended, only the periodic checks are left
+				sentinelChanges = nil
+				continue
+			}
+			log.Infof("Reboot sentinel changed, checking if a reboot is required")
+		}
+
 		if !window.Contains(time.Now()) {
 			// Remove taint outside the reboot time window to allow for normal operation.
 			preferNoScheduleTaint.Disable()
 			continue
 		}
 
-		if !checker.RebootRequired() {
+		result, err := checkRebootRequired(ctx, checker)
+		if err != nil {
+			log.Errorf("Unable to check if a reboot is required, will check again next period: %v", err)
+			leaveLockQueue(ctx, lock, nodeID)
+			continue
+		}
+		if !result.Required {
 			log.Infof("Reboot not required")
+			rebootLoopGauge.WithLabelValues(nodeID).Set(0)
+			rebootLoopNotified = false
 			preferNoScheduleTaint.Disable()
+			leaveLockQueue(ctx, lock, nodeID)
 			continue
 		}
 
@@ -643,7 +1129,29 @@ func rebootAsRequired(nodeID string, rebooter reboot.Rebooter, checker checkers.
 			log.Fatalf("Error retrieving node object via k8s API: %v", err)
 		}
 
-		nodeMeta := daemonsetlock.NodeMeta{Unschedulable: node.Spec.Unschedulable}
+		nodeMeta := daemonsetlock.NodeMeta{Unschedulable: node.Spec.Unschedulable, UID: node.UID}
+		if concurrencyTopologyKey != "" {
+			nodeMeta.Topology = node.Labels[concurrencyTopologyKey]
+		}
+
+		if rebootLoopMaxAttempts > 0 {
+			if attempts := nodeRebootAttempts(node, time.Now()); len(attempts) >= rebootLoopMaxAttempts {
+				log.Errorf("Reboot loop detected: reboot still required after %d reboots within %v, not rebooting until the reboots expire or the %s annotation is removed: %s",
+					len(attempts), rebootLoopPeriod, KuredRebootAttemptsAnnotation, describeRebootReason(result))
+				rebootLoopGauge.WithLabelValues(nodeID).Set(1)
+				if notifyURL != "" && !rebootLoopNotified {
+					if err := shoutrrr.Send(notifyURL, withReason(fmt.Sprintf(messageTemplateRebootLoop, nodeID), describeRebootReason(result))); err != nil {
+						log.Warnf("Error notifying: %v", err)
+					}
+				}
+				rebootLoopNotified = true
+				preferNoScheduleTaint.Disable()
+				leaveLockQueue(ctx, lock, nodeID)
+				continue
+			}
+			rebootLoopGauge.WithLabelValues(nodeID).Set(0)
+			rebootLoopNotified = false
+		}
 
 		var timeNowString string
 		if annotateNodes {
@@ -654,45 +1162,66 @@ func rebootAsRequired(nodeID string, rebooter reboot.Rebooter, checker checkers.
 				annotations := map[string]string{KuredRebootInProgressAnnotation: timeNowString}
 				// & annotate this node with a timestamp so that other node maintenance tools know how long it's been since this node has been marked for reboot
 				annotations[KuredMostRecentRebootNeededAnnotation] = timeNowString
+				// & with the reason of the reboot, so that operators know why this node is rebooted
+				annotations[KuredRebootReasonAnnotation] = describeRebootReason(result)
+				// & with the packages requiring the reboot, when known
+				if len(result.Details) > 0 {
+					annotations[KuredMostRecentRebootNeededPackagesAnnotation] = strings.Join(result.Details, ",")
+				}
 				err := addNodeAnnotations(client, nodeID, annotations)
 				if err != nil {
 					continue
 				}
+				// The packages of a previous reboot do not apply to this one
+				if _, ok := node.Annotations[KuredMostRecentRebootNeededPackagesAnnotation]; ok && len(result.Details) == 0 {
+					if err := deleteNodeAnnotation(client, nodeID, KuredMostRecentRebootNeededPackagesAnnotation); err != nil {
+						continue
+					}
+				}
 			}
 		}
 
 		var rebootRequiredBlockCondition string
 		if blockers.RebootBlocked(blockCheckers...) {
 			rebootRequiredBlockCondition = ", but blocked at this time"
+			leaveLockQueue(ctx, lock, nodeID)
 			continue
 		}
-		log.Infof("Reboot required%s", rebootRequiredBlockCondition)
+		log.Infof("Reboot required%s: %s", rebootRequiredBlockCondition, describeRebootReason(result))
 
-		holding, _, err := lock.Holding()
+		holding, _, err := lock.Holding(ctx)
 		if err != nil {
 			log.Errorf("Error testing lock: %v", err)
 		}
 
 		if !holding {
-			acquired, holder, err := lock.Acquire(nodeMeta)
+			acquired, holder, err := lock.Acquire(ctx, nodeMeta)
 			if err != nil {
 				log.Errorf("Error acquiring lock: %v", err)
 			}
+			lockQueuePositionGauge.WithLabelValues(nodeID).Set(float64(lock.QueuePosition()))
 			if !acquired {
 				log.Warnf("Lock already held: %v", holder)
+				if position := lock.QueuePosition(); position > 0 {
+					log.Infof("Waiting at position %d in the lock queue", position)
+				}
 				// Prefer to not schedule pods onto this node to avoid draing the same pod multiple times.
 				preferNoScheduleTaint.Enable()
 				continue
 			}
 		}
+		stopHeartbeat = startLockHeartbeat(ctx, lock)
 
-		err = drain(client, node)
+		err = drain(client, node, describeRebootReason(result))
 		if err != nil {
 			if !forceReboot {
 				log.Errorf("Unable to cordon or drain %s: %v, will release lock and retry cordon and drain before rebooting when lock is next acquired", node.GetName(), err)
-				err = lock.Release()
+				stopHeartbeat()
+				err = lock.Release(ctx, daemonsetlock.OutcomeDrainFailed)
 				if err != nil {
 					log.Errorf("Error releasing lock: %v", err)
+				} else {
+					updateLockHistoryMetrics(ctx, lock)
 				}
 				log.Infof("Performing a best-effort uncordon after failed cordon and drain")
 				err := uncordon(client, node)
@@ -709,19 +1238,37 @@ func rebootAsRequired(nodeID string, rebooter reboot.Rebooter, checker checkers.
 		}
 
 		if notifyURL != "" {
-			if err := shoutrrr.Send(notifyURL, fmt.Sprintf(messageTemplateReboot, nodeID)); err != nil {
+			if err := shoutrrr.Send(notifyURL, withReason(fmt.Sprintf(messageTemplateReboot, nodeID), describeRebootReason(result))); err != nil {
 				log.Warnf("Error notifying: %v", err)
 			}
 		}
+		// The boot ID recorded with the attempt allows to verify that the reboot happened:
+		// a reboot without it would be taken for an interrupted one once the node is back
+		if err := recordRebootAttempt(client, node); err != nil {
+			log.Errorf("Unable to record the reboot attempt: %v, will release lock and retry before rebooting when lock is next acquired", err)
+			stopHeartbeat()
+			err = lock.Release(ctx, daemonsetlock.OutcomeInterrupted)
+			if err != nil {
+				log.Errorf("Error releasing lock: %v", err)
+			} else {
+				updateLockHistoryMetrics(ctx, lock)
+			}
+			if !nodeMeta.Unschedulable {
+				log.Infof("Performing a best-effort uncordon after failing to record the reboot attempt")
+				if err := uncordon(client, node); err != nil {
+					log.Errorf("Failed to uncordon %s: %v", node.GetName(), err)
+				}
+			}
+			continue
+		}
 		log.Infof("Triggering reboot for node %v", nodeID)
 
-		err = rebooter.Reboot()
-		if err != nil {
-			log.Fatalf("Unable to reboot node: %v", err)
-		}
-		for {
-			log.Infof("Waiting for reboot")
-			time.Sleep(time.Minute)
+		if !rebootWithWatchdog(ctx, rebootMethods) {
+			return
 		}
+		// None of the reboot methods worked. The lock is kept, so that kured verifies the reboot
+		// when it restarts: once --reboot-deadline expired, the node is uncordoned according to
+		// its state before the lock was acquired, and the lock is released.
+		log.Fatalf("Node did not reboot with any of the reboot methods, exiting while holding the lock")
 	}
 }
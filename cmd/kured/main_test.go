@@ -3,6 +3,9 @@ package main
 import (
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/kubereboot/kured/pkg/checkers"
 )
 
 func TestValidateNotificationURL(t *testing.T) {
@@ -74,3 +77,74 @@ func Test_stripQuotes(t *testing.T) {
 		})
 	}
 }
+
+func TestIsControlPlaneNode(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodeLabels map[string]string
+		selector   string
+		expected   bool
+		wantErr    bool
+	}{
+		{"control plane role label", map[string]string{"node-role.kubernetes.io/control-plane": ""}, "node-role.kubernetes.io/control-plane", true, false},
+		{"worker without role label", map[string]string{"kubernetes.io/os": "linux"}, "node-role.kubernetes.io/control-plane", false, false},
+		{"label with value", map[string]string{"role": "etcd"}, "role=etcd", true, false},
+		{"label with other value", map[string]string{"role": "worker"}, "role=etcd", false, false},
+		{"invalid selector", nil, "role in (etcd", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := isControlPlaneNode(tt.nodeLabels, tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("isControlPlaneNode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if result != tt.expected {
+				t.Errorf("isControlPlaneNode() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDescribeRebootReason(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   checkers.Result
+		expected string
+	}{
+		{"no reason", checkers.Result{Required: true}, ""},
+		{"reason only", checkers.Result{Required: true, Reason: "sentinel file exists"}, "sentinel file exists"},
+		{"reason with details", checkers.Result{Required: true, Reason: "sentinel file exists", Details: []string{"linux-image", "libc6"}}, "sentinel file exists (linux-image, libc6)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := describeRebootReason(tt.result); result != tt.expected {
+				t.Errorf("describeRebootReason() = %q, expected %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRebootRequestFulfilled(t *testing.T) {
+	lockAcquired := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		requested    string
+		lockAcquired time.Time
+		expected     bool
+	}{
+		{"requested before the lock", "2024-05-01T09:00:00Z", lockAcquired, true},
+		{"requested after the lock", "2024-05-01T11:00:00Z", lockAcquired, false},
+		{"not a timestamp", "true", lockAcquired, true},
+		{"unknown lock acquisition", "2024-05-01T11:00:00Z", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := rebootRequestFulfilled(tt.requested, tt.lockAcquired); result != tt.expected {
+				t.Errorf("rebootRequestFulfilled() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
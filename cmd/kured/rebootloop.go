@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// bootIDPath is the file containing the ID of the current boot. It is the one of the kernel,
+// shared by all the containers of the host.
+const bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+// rebootAttempt is a reboot triggered by kured from the boot with the given ID.
+type rebootAttempt struct {
+	BootID string    `json:"bootID"`
+	Time   time.Time `json:"time"`
+}
+
+// readBootID returns the ID of the current boot.
+func readBootID(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading boot ID: %w", err)
+	}
+	bootID := strings.TrimSpace(string(content))
+	if bootID == "" {
+		return "", fmt.Errorf("error reading boot ID: %s is empty", path)
+	}
+	return bootID, nil
+}
+
+// parseRebootAttempts decodes the reboot attempts annotation. An empty value means no attempt.
+func parseRebootAttempts(value string) ([]rebootAttempt, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var attempts []rebootAttempt
+	if err := json.Unmarshal([]byte(value), &attempts); err != nil {
+		return nil, fmt.Errorf("error parsing reboot attempts %q: %w", value, err)
+	}
+	return attempts, nil
+}
+
+// recentRebootAttempts keeps the reboot attempts made within period before now.
+func recentRebootAttempts(attempts []rebootAttempt, now time.Time, period time.Duration) []rebootAttempt {
+	var recent []rebootAttempt
+	for _, attempt := range attempts {
+		if now.Sub(attempt.Time) < period {
+			recent = append(recent, attempt)
+		}
+	}
+	return recent
+}
+
+// addRebootAttempt records a reboot attempt from the boot with the given ID. Attempts from
+// the same boot, e.g. when kured restarted before the node rebooted, are only counted once.
+func addRebootAttempt(attempts []rebootAttempt, bootID string, now time.Time) []rebootAttempt {
+	var updated []rebootAttempt
+	for _, attempt := range attempts {
+		if attempt.BootID != bootID {
+			updated = append(updated, attempt)
+		}
+	}
+	return append(updated, rebootAttempt{BootID: bootID, Time: now})
+}
+
+// nodeRebootAttempts returns the recent reboot attempts recorded on the node.
+func nodeRebootAttempts(node *v1.Node, now time.Time) []rebootAttempt {
+	return recentRebootAttempts(allRebootAttempts(node), now, rebootLoopPeriod)
+}
+
+// allRebootAttempts returns all the reboot attempts recorded on the node, regardless of
+// --reboot-loop-period. Invalid records are ignored, as they cannot be counted.
+func allRebootAttempts(node *v1.Node) []rebootAttempt {
+	attempts, err := parseRebootAttempts(node.Annotations[KuredRebootAttemptsAnnotation])
+	if err != nil {
+		log.Warnf("Ignoring invalid reboot attempts annotation: %v", err)
+	}
+	return attempts
+}
+
+// recordRebootAttempt adds the reboot about to be triggered from the current boot to the
+// attempts recorded on the node.
+func recordRebootAttempt(client *kubernetes.Clientset, node *v1.Node) error {
+	bootID, err := readBootID(bootIDPath)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	attempts := addRebootAttempt(nodeRebootAttempts(node, now), bootID, now)
+	value, err := json.Marshal(attempts)
+	if err != nil {
+		return fmt.Errorf("error marshalling reboot attempts into JSON: %w", err)
+	}
+	return addNodeAnnotations(client, node.GetName(), map[string]string{KuredRebootAttemptsAnnotation: string(value)})
+}
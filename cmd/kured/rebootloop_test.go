@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRebootAttempts(t *testing.T) {
+	now := time.Date(2024, 5, 5, 15, 0, 0, 0, time.UTC)
+
+	attempts, err := parseRebootAttempts("")
+	if err != nil || attempts != nil {
+		t.Fatalf("parseRebootAttempts() = %v, %v for an empty value, want no attempt", attempts, err)
+	}
+	if _, err := parseRebootAttempts("3"); err == nil {
+		t.Errorf("parseRebootAttempts() expected an error for an invalid value")
+	}
+
+	attempts = addRebootAttempt(attempts, "boot-1", now.Add(-25*time.Hour))
+	attempts = addRebootAttempt(attempts, "boot-2", now.Add(-2*time.Hour))
+	attempts = addRebootAttempt(attempts, "boot-3", now.Add(-time.Hour))
+	// kured restarted before the node rebooted: the attempt from boot-3 is only counted once
+	attempts = addRebootAttempt(attempts, "boot-3", now)
+	if len(attempts) != 3 {
+		t.Fatalf("addRebootAttempt() recorded %d attempts, want 3: %v", len(attempts), attempts)
+	}
+	if last := attempts[2]; last.BootID != "boot-3" || !last.Time.Equal(now) {
+		t.Errorf("addRebootAttempt() last attempt = %v, want boot-3 at %v", last, now)
+	}
+
+	recent := recentRebootAttempts(attempts, now, 24*time.Hour)
+	if len(recent) != 2 || recent[0].BootID != "boot-2" {
+		t.Errorf("recentRebootAttempts() = %v, want the attempts from boot-2 and boot-3", recent)
+	}
+}
+
+func TestReadBootID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "boot_id")
+	if _, err := readBootID(path); err == nil {
+		t.Errorf("readBootID() expected an error for a missing file")
+	}
+	if err := os.WriteFile(path, []byte("0f3a9a3e-58a1-4b1e-9b33-0c2b3c7b1f4d\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readBootID(path); err != nil || got != "0f3a9a3e-58a1-4b1e-9b33-0c2b3c7b1f4d" {
+		t.Errorf("readBootID() = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"time"
+
+	"github.com/kubereboot/kured/pkg/daemonsetlock"
+	v1 "k8s.io/api/core/v1"
+)
+
+// Results of the verification of the reboot, when kured starts while holding the lock.
+const (
+	// rebootVerified means the node booted since kured triggered the reboot
+	rebootVerified = "rebooted"
+	// rebootPending means the reboot was triggered from the current boot less than
+	// --reboot-deadline ago, or without deadline: kured restarted while the node is going down
+	rebootPending = "pending"
+	// rebootInterrupted means no reboot was triggered since the lock was acquired:
+	// kured restarted while draining the node, before triggering the reboot
+	rebootInterrupted = "interrupted"
+	// rebootNotHappened means the reboot was triggered from the current boot more than
+	// --reboot-deadline ago: the node did not reboot
+	rebootNotHappened = "not-rebooted"
+)
+
+// verifyReboot compares the current boot to the last reboot attempt recorded on the node,
+// to find out whether the reboot for which the lock was acquired at lockAcquired happened.
+// The attempts are not limited to --reboot-loop-period, which may be shorter than the lock.
+func verifyReboot(node *v1.Node, bootID string, lockAcquired, now time.Time) (string, rebootAttempt) {
+	attempts := allRebootAttempts(node)
+	if len(attempts) == 0 {
+		return rebootInterrupted, rebootAttempt{}
+	}
+	last := attempts[len(attempts)-1]
+	if last.Time.Before(lockAcquired) {
+		// The attempt was recorded for a previous lock
+		return rebootInterrupted, rebootAttempt{}
+	}
+	if last.BootID != bootID {
+		return rebootVerified, last
+	}
+	if rebootDeadline <= 0 || now.Sub(last.Time) < rebootDeadline {
+		return rebootPending, last
+	}
+	return rebootNotHappened, last
+}
+
+// releaseOutcome is the outcome recorded in the lock history for the verification of the reboot.
+func releaseOutcome(verification string) string {
+	switch verification {
+	case rebootInterrupted:
+		return daemonsetlock.OutcomeInterrupted
+	case rebootNotHappened:
+		return daemonsetlock.OutcomeNotRebooted
+	default:
+		return daemonsetlock.OutcomeRebooted
+	}
+}
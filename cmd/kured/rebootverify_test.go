@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVerifyReboot(t *testing.T) {
+	now := time.Date(2024, 5, 5, 15, 0, 0, 0, time.UTC)
+	lockAcquired := now.Add(-time.Hour)
+	attempts := func(value string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{KuredRebootAttemptsAnnotation: value}}}
+	}
+
+	tests := []struct {
+		name string
+		node *v1.Node
+		want string
+	}{
+		{
+			name: "no recorded attempt",
+			node: &v1.Node{},
+			want: rebootInterrupted,
+		},
+		{
+			name: "attempt recorded for a previous lock",
+			node: attempts(`[{"bootID":"boot-1","time":"2024-05-05T13:00:00Z"}]`),
+			want: rebootInterrupted,
+		},
+		{
+			name: "attempt from another boot",
+			node: attempts(`[{"bootID":"boot-1","time":"2024-05-05T14:30:00Z"}]`),
+			want: rebootVerified,
+		},
+		{
+			name: "recent attempt from the current boot",
+			node: attempts(`[{"bootID":"boot-2","time":"2024-05-05T14:55:00Z"}]`),
+			want: rebootPending,
+		},
+		{
+			name: "old attempt from the current boot",
+			node: attempts(`[{"bootID":"boot-1","time":"2024-05-05T13:00:00Z"},{"bootID":"boot-2","time":"2024-05-05T14:30:00Z"}]`),
+			want: rebootNotHappened,
+		},
+	}
+	oldRebootDeadline, oldRebootLoopPeriod := rebootDeadline, rebootLoopPeriod
+	t.Cleanup(func() { rebootDeadline, rebootLoopPeriod = oldRebootDeadline, oldRebootLoopPeriod })
+	rebootDeadline = 10 * time.Minute
+	// Attempts older than the reboot loop period are still verified
+	rebootLoopPeriod = 20 * time.Minute
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := verifyReboot(tt.node, "boot-2", lockAcquired, now); got != tt.want {
+				t.Errorf("verifyReboot() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
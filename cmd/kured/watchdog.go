@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containrrr/shoutrrr"
+	"github.com/kubereboot/kured/internal"
+	"github.com/kubereboot/kured/pkg/reboot"
+	log "github.com/sirupsen/logrus"
+)
+
+// namedRebooter is a rebooter, with the name of its method for the logs and metrics.
+type namedRebooter struct {
+	name     string
+	rebooter reboot.Rebooter
+}
+
+// newRebootMethods builds the rebooters of the reboot method, followed by the fallback methods.
+func newRebootMethods(method string, fallbacks []string) ([]namedRebooter, error) {
+	var methods []namedRebooter
+	for _, name := range append([]string{method}, fallbacks...) {
+		rebooter, err := internal.NewRebooter(name, rebootCommand, rebootSignal)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, namedRebooter{name: name, rebooter: rebooter})
+	}
+	return methods, nil
+}
+
+// rebootWithWatchdog triggers the reboot with each of the methods in turn, escalating to the next
+// one when the node did not go down within --reboot-deadline, or when the method failed.
+// It returns true when all of them were exhausted, false when ctx ended, as kured is terminated
+// by the reboot. Without deadline or fallback methods, it waits for the reboot of the first
+// working method forever: the node might still be going down, however slowly.
+func rebootWithWatchdog(ctx context.Context, methods []namedRebooter) bool {
+	deadline := rebootDeadline
+	if len(methods) < 2 {
+		deadline = 0
+	}
+	for i, method := range methods {
+		if i > 0 {
+			log.Warnf("Node did not reboot, escalating to reboot method %s", method.name)
+			if notifyURL != "" {
+				if err := shoutrrr.Send(notifyURL, withReason(fmt.Sprintf(messageTemplateRebootEscalation, nodeID), "trying reboot method "+method.name)); err != nil {
+					log.Warnf("Error notifying: %v", err)
+				}
+			}
+		}
+		rebootTriggersCounter.WithLabelValues(nodeID, method.name).Inc()
+		if err := method.rebooter.Reboot(); err != nil {
+			log.Errorf("Unable to reboot node with method %s: %v", method.name, err)
+			continue
+		}
+		if !waitForReboot(ctx, deadline) {
+			return false
+		}
+	}
+	return true
+}
+
+// waitForReboot waits for the node to go down, and returns true when it did not within
+// deadline, false when ctx ended first. A deadline lower than or equal to zero never expires.
+func waitForReboot(ctx context.Context, deadline time.Duration) bool {
+	var expired <-chan time.Time
+	if deadline > 0 {
+		timer := time.NewTimer(deadline)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		log.Infof("Waiting for reboot")
+		select {
+		case <-ctx.Done():
+			return false
+		case <-expired:
+			return true
+		case <-ticker.C:
+		}
+	}
+}
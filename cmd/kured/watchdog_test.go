@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeRebooter struct {
+	calls *[]string
+	name  string
+	err   error
+}
+
+func (f fakeRebooter) Reboot() error {
+	*f.calls = append(*f.calls, f.name)
+	return f.err
+}
+
+func TestRebootWithWatchdog(t *testing.T) {
+	oldRebootDeadline := rebootDeadline
+	t.Cleanup(func() { rebootDeadline = oldRebootDeadline })
+	rebootDeadline = 10 * time.Millisecond
+	var calls []string
+	methods := []namedRebooter{
+		{name: "command", rebooter: fakeRebooter{calls: &calls, name: "command"}},
+		{name: "signal", rebooter: fakeRebooter{calls: &calls, name: "signal", err: errors.New("signal failed")}},
+		{name: "sysrq", rebooter: fakeRebooter{calls: &calls, name: "sysrq"}},
+	}
+
+	if gaveUp := rebootWithWatchdog(context.Background(), methods); !gaveUp {
+		t.Errorf("rebootWithWatchdog() = false, want to give up when the node never reboots")
+	}
+	if len(calls) != 3 || calls[0] != "command" || calls[1] != "signal" || calls[2] != "sysrq" {
+		t.Errorf("rebootWithWatchdog() triggered %v, want command, signal then sysrq", calls)
+	}
+
+	// Without fallback methods, the reboot is waited for until kured is terminated by it
+	calls = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 5*rebootDeadline)
+	defer cancel()
+	if gaveUp := rebootWithWatchdog(ctx, methods[:1]); gaveUp {
+		t.Errorf("rebootWithWatchdog() = true, want to wait for the reboot without fallback methods")
+	}
+	if len(calls) != 1 {
+		t.Errorf("rebootWithWatchdog() triggered %v, want only the reboot method", calls)
+	}
+
+	// kured is terminated by the reboot: no escalation
+	calls = nil
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if gaveUp := rebootWithWatchdog(ctx, methods); gaveUp {
+		t.Errorf("rebootWithWatchdog() = true, want false when terminated")
+	}
+	if len(calls) != 1 {
+		t.Errorf("rebootWithWatchdog() triggered %v, want only the first method", calls)
+	}
+
+	// A single reboot method which fails is given up immediately
+	calls = nil
+	if gaveUp := rebootWithWatchdog(context.Background(), methods[1:2]); !gaveUp {
+		t.Errorf("rebootWithWatchdog() = false, want to give up when the only reboot method fails")
+	}
+	if len(calls) != 1 || calls[0] != "signal" {
+		t.Errorf("rebootWithWatchdog() triggered %v, want only the signal method", calls)
+	}
+}
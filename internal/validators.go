@@ -7,6 +7,8 @@ package internal
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/kubereboot/kured/pkg/checkers"
 	"github.com/kubereboot/kured/pkg/reboot"
@@ -23,19 +25,96 @@ func NewRebooter(rebootMethod string, rebootCommand string, rebootSignal int) (r
 	case "signal":
 		log.Infof("Reboot signal: %d", rebootSignal)
 		return reboot.NewSignalRebooter(rebootSignal)
+	case "sysrq":
+		log.Infof("Reboot sysrq trigger: %s", reboot.DefaultSysrqTriggerPath)
+		return reboot.NewSysrqRebooter()
 	default:
-		return nil, fmt.Errorf("invalid reboot-method configured %s, expected signal or command", rebootMethod)
+		return nil, fmt.Errorf("invalid reboot-method configured %s, expected signal, command or sysrq", rebootMethod)
 	}
 }
 
-// NewRebootChecker validates the rebootSentinelCommand, rebootSentinelFile input,
-// then chains to the right constructor.
-func NewRebootChecker(rebootSentinelCommand string, rebootSentinelFile string) (checkers.Checker, error) {
+// NewRebootChecker validates the rebootCheckers and rebootCheckerMode input, then chains to
+// the right constructors. Without rebootCheckers, it falls back to the rebootSentinelCommand,
+// then to the rebootSentinelFile. The packages requiring the reboot are read next to all the
+// sentinel files when readPackages is set, and the commandOptions apply to all the command checkers.
+func NewRebootChecker(rebootCheckers []string, rebootCheckerMode string, rebootSentinelCommand string, rebootSentinelFile string, readPackages bool, commandOptions ...checkers.CommandOption) (checkers.Checker, error) {
+	var fileOptions []checkers.FileOption
+	if readPackages {
+		fileOptions = append(fileOptions, checkers.WithPackages())
+	}
+	if len(rebootCheckers) > 0 {
+		var namedCheckers []checkers.NamedChecker
+		for _, spec := range rebootCheckers {
+			checker, err := newNamedChecker(spec, fileOptions, commandOptions)
+			if err != nil {
+				return nil, err
+			}
+			namedCheckers = append(namedCheckers, checker)
+		}
+		composite, err := checkers.NewCompositeChecker(rebootCheckerMode, namedCheckers...)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Reboot checkers (reboot when %s of them require it): %s", rebootCheckerMode, strings.Join(rebootCheckers, ", "))
+		return composite, nil
+	}
+
 	// An override of rebootSentinelCommand means a privileged command
 	if rebootSentinelCommand != "" {
 		log.Infof("Sentinel checker is (privileged) user provided command: %s", rebootSentinelCommand)
-		return checkers.NewCommandChecker(rebootSentinelCommand, 1, true)
+		return checkers.NewCommandChecker(rebootSentinelCommand, 1, true, commandOptions...)
 	}
 	log.Infof("Sentinel checker is (unprivileged) testing for the presence of: %s", rebootSentinelFile)
-	return checkers.NewFileRebootChecker(rebootSentinelFile)
+	return checkers.NewFileRebootChecker(rebootSentinelFile, fileOptions...)
+}
+
+// parseCheckerSpec splits a reboot checker specification of the form [name=]type:argument.
+// The name defaults to type:argument.
+func parseCheckerSpec(spec string) (name, checkerType, argument string, err error) {
+	definition, argument, found := strings.Cut(spec, ":")
+	if !found || argument == "" {
+		return "", "", "", fmt.Errorf("invalid reboot checker %q, expected [name=]type:argument", spec)
+	}
+	name, checkerType, named := strings.Cut(definition, "=")
+	if !named {
+		name, checkerType = spec, definition
+	}
+	if name == "" || checkerType == "" {
+		return "", "", "", fmt.Errorf("invalid reboot checker %q, expected [name=]type:argument", spec)
+	}
+	return name, checkerType, argument, nil
+}
+
+// newNamedChecker builds the checker described by a [name=]type:argument specification.
+func newNamedChecker(spec string, fileOptions []checkers.FileOption, commandOptions []checkers.CommandOption) (checkers.NamedChecker, error) {
+	name, checkerType, argument, err := parseCheckerSpec(spec)
+	if err != nil {
+		return checkers.NamedChecker{}, err
+	}
+	var checker checkers.Checker
+	switch checkerType {
+	case "file":
+		checker, err = checkers.NewFileRebootChecker(argument, fileOptions...)
+	case "command":
+		// Commands are run privileged, like the rebootSentinelCommand
+		checker, err = checkers.NewCommandChecker(argument, 1, true, commandOptions...)
+	case "rpm-ostree":
+		checker, err = checkers.NewRpmOstreeChecker(argument, 1, true, commandOptions...)
+	case "transactional-update":
+		checker, err = checkers.NewTransactionalUpdateChecker(argument, 1, true, commandOptions...)
+	case "kernel":
+		checker, err = checkers.NewKernelChecker(argument)
+	case "uptime":
+		maxUptime, parseErr := time.ParseDuration(argument)
+		if parseErr != nil {
+			return checkers.NamedChecker{}, fmt.Errorf("invalid maximum uptime in reboot checker %q: %w", spec, parseErr)
+		}
+		checker, err = checkers.NewUptimeChecker(maxUptime)
+	default:
+		return checkers.NamedChecker{}, fmt.Errorf("invalid reboot checker type %s in %q, expected file, command, rpm-ostree, transactional-update, kernel or uptime", checkerType, spec)
+	}
+	if err != nil {
+		return checkers.NamedChecker{}, err
+	}
+	return checkers.NamedChecker{Name: name, Checker: checker}, nil
 }
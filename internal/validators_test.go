@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestParseCheckerSpec(t *testing.T) {
+	tests := []struct {
+		spec        string
+		name        string
+		checkerType string
+		argument    string
+		wantErr     bool
+	}{
+		{spec: "file:/var/run/reboot-required", name: "file:/var/run/reboot-required", checkerType: "file", argument: "/var/run/reboot-required"},
+		{spec: "apt=file:/var/run/reboot-required", name: "apt", checkerType: "file", argument: "/var/run/reboot-required"},
+		{spec: "dnf=command:needs-restarting -r", name: "dnf", checkerType: "command", argument: "needs-restarting -r"},
+		{spec: "command:test --value=1", name: "command:test --value=1", checkerType: "command", argument: "test --value=1"},
+		{spec: "coreos=rpm-ostree:/usr/bin/rpm-ostree", name: "coreos", checkerType: "rpm-ostree", argument: "/usr/bin/rpm-ostree"},
+		{spec: "/var/run/reboot-required", wantErr: true},
+		{spec: "file:", wantErr: true},
+		{spec: "=file:/var/run/reboot-required", wantErr: true},
+		{spec: "apt=:/var/run/reboot-required", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			name, checkerType, argument, err := parseCheckerSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCheckerSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.name || checkerType != tt.checkerType || argument != tt.argument {
+				t.Errorf("parseCheckerSpec() = %q, %q, %q, want %q, %q, %q", name, checkerType, argument, tt.name, tt.checkerType, tt.argument)
+			}
+		})
+	}
+}
+
+func TestNewRebootChecker(t *testing.T) {
+	if _, err := NewRebootChecker([]string{"unknown:arg"}, "any", "", "/var/run/reboot-required", false); err == nil {
+		t.Errorf("expected an error for an unknown checker type")
+	}
+	if _, err := NewRebootChecker([]string{"file:/var/run/reboot-required"}, "some", "", "/var/run/reboot-required", false); err == nil {
+		t.Errorf("expected an error for an invalid mode")
+	}
+	if _, err := NewRebootChecker([]string{"uptime:30d"}, "any", "", "/var/run/reboot-required", false); err == nil {
+		t.Errorf("expected an error for an invalid maximum uptime")
+	}
+	if _, err := NewRebootChecker(nil, "some", "", "/var/run/reboot-required", false); err != nil {
+		t.Errorf("mode should be ignored without reboot checkers, got %v", err)
+	}
+}
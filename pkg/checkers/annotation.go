@@ -0,0 +1,41 @@
+package checkers
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeAnnotationChecker requires a reboot when the node carries the given annotation,
+// allowing operators and controllers to request a reboot through the Kubernetes API.
+// The annotation is expected to be removed once the node rebooted.
+type NodeAnnotationChecker struct {
+	// client used to contact kubernetes API
+	client     *kubernetes.Clientset
+	nodeName   string
+	annotation string
+}
+
+// NewNodeAnnotationChecker is the constructor for the node annotation checker.
+func NewNodeAnnotationChecker(client *kubernetes.Clientset, nodename string, annotation string) *NodeAnnotationChecker {
+	return &NodeAnnotationChecker{
+		client:     client,
+		nodeName:   nodename,
+		annotation: annotation,
+	}
+}
+
+// RebootRequired checks the presence of the annotation on the node.
+func (nc NodeAnnotationChecker) RebootRequired() (Result, error) {
+	node, err := nc.client.CoreV1().Nodes().Get(context.TODO(), nc.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return Result{}, fmt.Errorf("error retrieving node object via k8s API: %w", err)
+	}
+	value, requested := node.Annotations[nc.annotation]
+	if !requested {
+		return Result{}, nil
+	}
+	return Result{Required: true, Reason: fmt.Sprintf("reboot requested through node annotation %s=%s", nc.annotation, value)}, nil
+}
@@ -8,10 +8,14 @@ package checkers
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/google/shlex"
 	log "github.com/sirupsen/logrus"
@@ -19,37 +23,119 @@ import (
 
 // Checker is the standard interface to use to check
 // if a reboot is required. Its types must implement a
-// CheckRebootRequired method which returns a single boolean
-// clarifying whether a reboot is expected or not.
+// RebootRequired method which returns a Result clarifying
+// whether a reboot is expected or not, and why, or an error
+// when the check itself failed.
 type Checker interface {
-	RebootRequired() bool
+	RebootRequired() (Result, error)
 }
 
+// Result is the outcome of a successful reboot check.
+type Result struct {
+	// Required is true when the node needs a reboot
+	Required bool
+	// Reason explains why a reboot is required
+	Reason string
+	// Details optionally lists what requires the reboot, e.g. packages
+	Details []string
+}
+
+// PackagesSuffix is appended to the sentinel file path to find the companion file listing
+// the packages requiring the reboot, e.g. /var/run/reboot-required.pkgs on Debian and Ubuntu.
+const PackagesSuffix = ".pkgs"
+
 // FileRebootChecker is the default reboot checker.
 // It is unprivileged, and tests the presence of a files
 type FileRebootChecker struct {
 	FilePath string
+	// PackagesPath optionally lists the packages requiring the reboot, one per line
+	PackagesPath string
+}
+
+// FileOption allows to change the configuration of the FileRebootChecker.
+type FileOption func(*FileRebootChecker)
+
+// WithPackages reads the packages requiring the reboot from the companion file
+// of the sentinel, suffixed with PackagesSuffix.
+func WithPackages() FileOption {
+	return func(rc *FileRebootChecker) {
+		rc.PackagesPath = rc.FilePath + PackagesSuffix
+	}
+}
+
+// RebootRequired checks the file presence. Errors other than
+// the file not existing are returned. The packages requiring the reboot
+// are returned as details, when they can be read.
+func (rc FileRebootChecker) RebootRequired() (Result, error) {
+	_, err := os.Stat(rc.FilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Result{}, nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("error checking sentinel file: %w", err)
+	}
+	return Result{Required: true, Reason: fmt.Sprintf("sentinel file %s exists", rc.FilePath), Details: rc.packages()}, nil
 }
 
-// RebootRequired checks the file presence
-// needs refactoring to also return an error, instead of leaking it inside the code.
-// This needs refactoring to get rid of NewCommand
-// This needs refactoring to only contain file location, instead of CheckCommand
-func (rc FileRebootChecker) RebootRequired() bool {
-	if _, err := os.Stat(rc.FilePath); err == nil {
-		return true
+// packages reads the packages listed in PackagesPath, without duplicates. The packages are
+// only informative: failing to read them does not fail the check.
+func (rc FileRebootChecker) packages() []string {
+	if rc.PackagesPath == "" {
+		return nil
+	}
+	content, err := os.ReadFile(rc.PackagesPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("Unable to read the packages requiring a reboot: %v", err)
+		}
+		return nil
+	}
+	var packages []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(content), "\n") {
+		pkg := strings.TrimSpace(line)
+		if pkg == "" || seen[pkg] {
+			continue
+		}
+		seen[pkg] = true
+		packages = append(packages, pkg)
 	}
-	return false
+	return packages
 }
 
 // NewFileRebootChecker is the constructor for the file based reboot checker
 // TODO: Add extra input validation on filePath string here
-func NewFileRebootChecker(filePath string) (*FileRebootChecker, error) {
-	return &FileRebootChecker{
+func NewFileRebootChecker(filePath string, opts ...FileOption) (*FileRebootChecker, error) {
+	rc := &FileRebootChecker{
 		FilePath: filePath,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(rc)
+	}
+	return rc, nil
 }
 
+// DefaultCommandTimeout is the default time given to a sentinel command to complete.
+const DefaultCommandTimeout = 5 * time.Minute
+
+// DefaultCommandMaxOutput is the default amount of bytes of the sentinel command
+// stdout and stderr which are kept, each.
+const DefaultCommandMaxOutput = 64 * 1024
+
+// commandMaxParsedOutput is the amount of bytes of stdout kept for the commands whose
+// output is parsed, such as rpm-ostree status. It is not limited by MaxOutput, as the
+// whole output is needed, but is still bounded so that a misbehaving command cannot
+// exhaust the memory of kured.
+const commandMaxParsedOutput = 4 * 1024 * 1024
+
+// commandWaitDelay bounds the wait for the output of the processes left behind by
+// a killed sentinel command, which could otherwise keep its stdout or stderr open.
+const commandWaitDelay = 5 * time.Second
+
+// ErrCommandTimeout is returned when the sentinel command did not complete in time.
+// The command, with all the processes it started, is killed.
+var ErrCommandTimeout = errors.New("sentinel command timed out")
+
 // CommandChecker is using a custom command to check
 // if a reboot is required. There are two modes of behaviour,
 // if Privileged is granted, the NamespacePid is used to nsenter
@@ -58,38 +144,97 @@ type CommandChecker struct {
 	CheckCommand []string
 	NamespacePid int
 	Privileged   bool
+	// Timeout after which the command is killed, 0 to wait forever
+	Timeout time.Duration
+	// MaxOutput is the amount of bytes of stdout and stderr kept, each, 0 to keep all of it
+	MaxOutput int
 }
 
-// RebootRequired for CommandChecker runs a command without returning
-// any eventual error. This should be later refactored to return the errors,
-// instead of logging and fataling them here.
-func (rc CommandChecker) RebootRequired() bool {
-	bufStdout := new(bytes.Buffer)
-	bufStderr := new(bytes.Buffer)
+// CommandOption allows to change the configuration of the CommandChecker.
+type CommandOption func(*CommandChecker)
+
+// WithCommandTimeout kills the command, and the processes it started, when it does not
+// complete within timeout. A timeout lower than or equal to zero disables it.
+func WithCommandTimeout(timeout time.Duration) CommandOption {
+	return func(rc *CommandChecker) {
+		rc.Timeout = max(timeout, 0)
+	}
+}
+
+// WithCommandMaxOutput limits the amount of bytes of stdout and stderr kept, each,
+// to maxOutput. Beyond it, the output is discarded. A limit lower than or equal to
+// zero keeps all the output.
+func WithCommandMaxOutput(maxOutput int) CommandOption {
+	return func(rc *CommandChecker) {
+		rc.MaxOutput = max(maxOutput, 0)
+	}
+}
+
+// RebootRequired for CommandChecker runs the command: a zero exit code means
+// a reboot is required, and any other exit code means it is not. Failing to run
+// the command, or the command timing out, is returned as an error.
+func (rc CommandChecker) RebootRequired() (Result, error) {
+	stdout, stderr, err := rc.run(rc.MaxOutput)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.Is(err, ErrCommandTimeout) || !errors.As(err, &exitErr) {
+			// Something was grossly misconfigured, such as the command path being wrong,
+			// or the command hangs: the check failed.
+			return Result{}, err
+		}
+		// We assume a non-zero exit code means 'reboot not required', but of course
+		// the user could have misconfigured the sentinel command or something else
+		// went wrong during its execution. In that case, not entering a reboot loop
+		// is the right thing to do, and we are logging stdout/stderr of the command
+		// so it should be obvious what is wrong.
+		if exitErr.ExitCode() != 1 {
+			log.Warnf("Sentinel command %s ended with unexpected exit code %d, stdout: %q, stderr: %q", strings.Join(rc.CheckCommand, " "), exitErr.ExitCode(), stdout, stderr)
+		}
+		return Result{}, nil
+	}
+	log.Infof("Sentinel command %s requires a reboot, stdout: %q, stderr: %q", strings.Join(rc.CheckCommand, " "), stdout, stderr)
+	return Result{Required: true, Reason: fmt.Sprintf("sentinel command %s succeeded", strings.Join(rc.CheckCommand, " "))}, nil
+}
+
+// output runs the command, and returns its whole stdout when it succeeds.
+// Output longer than commandMaxParsedOutput cannot be parsed, and is returned as an error.
+func (rc CommandChecker) output() ([]byte, error) {
+	stdout, _, err := rc.run(commandMaxParsedOutput)
+	if err != nil {
+		return nil, err
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("output of sentinel command %s exceeds %d bytes", strings.Join(rc.CheckCommand, " "), commandMaxParsedOutput)
+	}
+	return stdout.buf.Bytes(), nil
+}
+
+// run runs the command within the timeout, keeping up to maxStdout bytes of its stdout
+// and MaxOutput bytes of its stderr. Failures, including non-zero exit codes, are returned
+// as an error wrapping the exec error, or ErrCommandTimeout.
+func (rc CommandChecker) run(maxStdout int) (*limitedBuffer, *limitedBuffer, error) {
+	ctx := context.Background()
+	if rc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rc.Timeout)
+		defer cancel()
+	}
+	bufStdout := &limitedBuffer{limit: maxStdout}
+	bufStderr := &limitedBuffer{limit: rc.MaxOutput}
 	// #nosec G204 -- CheckCommand is controlled and validated internally
-	cmd := exec.Command(rc.CheckCommand[0], rc.CheckCommand[1:]...)
+	cmd := exec.CommandContext(ctx, rc.CheckCommand[0], rc.CheckCommand[1:]...)
 	cmd.Stdout = bufStdout
 	cmd.Stderr = bufStderr
+	cmd.WaitDelay = commandWaitDelay
+	killProcessGroupOnCancel(cmd)
 
 	if err := cmd.Run(); err != nil {
-		switch err := err.(type) {
-		case *exec.ExitError:
-			// We assume a non-zero exit code means 'reboot not required', but of course
-			// the user could have misconfigured the sentinel command or something else
-			// went wrong during its execution. In that case, not entering a reboot loop
-			// is the right thing to do, and we are logging stdout/stderr of the command
-			// so it should be obvious what is wrong.
-			if cmd.ProcessState.ExitCode() != 1 {
-				log.Warn(fmt.Sprintf("sentinel command ended with unexpected exit code: %v", cmd.ProcessState.ExitCode()), "cmd", strings.Join(cmd.Args, " "), "stdout", bufStdout.String(), "stderr", bufStderr.String())
-			}
-			return false
-		default:
-			// Something was grossly misconfigured, such as the command path being wrong.
-			log.Fatal(fmt.Sprintf("Error invoking sentinel command: %v", err), "cmd", strings.Join(cmd.Args, " "), "stdout", bufStdout.String(), "stderr", bufStderr.String())
+		if ctx.Err() != nil {
+			return bufStdout, bufStderr, fmt.Errorf("%w after %v: %s (stdout: %q, stderr: %q)", ErrCommandTimeout, rc.Timeout, strings.Join(cmd.Args, " "), bufStdout.String(), bufStderr.String())
 		}
+		return bufStdout, bufStderr, fmt.Errorf("error invoking sentinel command %s: %w (stdout: %q, stderr: %q)", strings.Join(cmd.Args, " "), err, bufStdout.String(), bufStderr.String())
 	}
-	log.Info("checking if reboot is required", "cmd", strings.Join(cmd.Args, " "), "stdout", bufStdout.String(), "stderr", bufStderr.String())
-	return true
+	return bufStdout, bufStderr, nil
 }
 
 // NewCommandChecker is the constructor for the commandChecker, and by default
@@ -99,19 +244,54 @@ func (rc CommandChecker) RebootRequired() bool {
 // This relies on hostPID:true and privileged:true to enter host mount space
 // For info, rancher based need different pid, which should be user given.
 // until we have a better discovery mechanism.
-func NewCommandChecker(sentinelCommand string, pid int, privileged bool) (*CommandChecker, error) {
-	var cmd []string
-	if privileged {
-		cmd = append(cmd, "/usr/bin/nsenter", fmt.Sprintf("-m/proc/%d/ns/mnt", pid), "--")
-	}
+func NewCommandChecker(sentinelCommand string, pid int, privileged bool, opts ...CommandOption) (*CommandChecker, error) {
 	parsedCommand, err := shlex.Split(sentinelCommand)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing provided sentinel command: %v", err)
 	}
-	cmd = append(cmd, parsedCommand...)
-	return &CommandChecker{
+	return newCommandChecker(parsedCommand, pid, privileged, opts...), nil
+}
+
+// newCommandChecker builds the CommandChecker running the already parsed command,
+// wrapped with nsenter when privileged.
+func newCommandChecker(command []string, pid int, privileged bool, opts ...CommandOption) *CommandChecker {
+	var cmd []string
+	if privileged {
+		cmd = append(cmd, "/usr/bin/nsenter", fmt.Sprintf("-m/proc/%d/ns/mnt", pid), "--")
+	}
+	cmd = append(cmd, command...)
+	rc := &CommandChecker{
 		CheckCommand: cmd,
 		NamespacePid: pid,
 		Privileged:   privileged,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(rc)
+	}
+	return rc
+}
+
+// limitedBuffer keeps the first limit bytes written to it, and discards the rest
+// without failing the writes, so that the command is not disturbed.
+// A limit of zero keeps everything.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	if lb.limit > 0 && lb.buf.Len()+len(p) > lb.limit {
+		lb.truncated = true
+		lb.buf.Write(p[:max(lb.limit-lb.buf.Len(), 0)])
+		return len(p), nil
+	}
+	return lb.buf.Write(p)
+}
+
+func (lb *limitedBuffer) String() string {
+	if lb.truncated {
+		return lb.buf.String() + "... (truncated)"
+	}
+	return lb.buf.String()
 }
@@ -1,9 +1,14 @@
 package checkers
 
 import (
-	log "github.com/sirupsen/logrus"
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_nsEntering(t *testing.T) {
@@ -38,50 +43,143 @@ func Test_rebootRequired(t *testing.T) {
 		sentinelCommand []string
 	}
 	tests := []struct {
-		name   string
-		args   args
-		want   bool
-		fatals bool
+		name    string
+		args    args
+		want    bool
+		wantErr bool
 	}{
 		{
 			name: "Ensure rc = 0 means reboot required",
 			args: args{
 				sentinelCommand: []string{"true"},
 			},
-			want:   true,
-			fatals: false,
+			want:    true,
+			wantErr: false,
 		},
 		{
-			name: "Ensure rc != 0 means reboot NOT required",
+			name: "Ensure rc = 1 means reboot NOT required",
 			args: args{
 				sentinelCommand: []string{"false"},
 			},
-			want:   false,
-			fatals: false,
+			want:    false,
+			wantErr: false,
 		},
 		{
-			name: "Ensure a wrong command fatals",
+			name: "Ensure an unexpected rc means reboot NOT required",
+			args: args{
+				sentinelCommand: []string{"sh", "-c", "exit 2"},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name: "Ensure a wrong command returns an error",
 			args: args{
 				sentinelCommand: []string{"./babar"},
 			},
-			want:   true,
-			fatals: true,
+			want:    false,
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			defer func() { log.StandardLogger().ExitFunc = nil }()
-			fatal := false
-			log.StandardLogger().ExitFunc = func(int) { fatal = true }
-
 			a := CommandChecker{CheckCommand: tt.args.sentinelCommand, NamespacePid: 1, Privileged: false}
 
-			if got := a.RebootRequired(); got != tt.want {
-				t.Errorf("rebootRequired() = %v, want %v", got, tt.want)
+			got, err := a.RebootRequired()
+			if got.Required != tt.want {
+				t.Errorf("rebootRequired() = %v, want %v", got.Required, tt.want)
 			}
-			if tt.fatals != fatal {
-				t.Errorf("fatal flag is %v, want fatal %v", fatal, tt.fatals)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("rebootRequired() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestFileRebootChecker(t *testing.T) {
+	dir := t.TempDir()
+	sentinel := filepath.Join(dir, "reboot-required")
+
+	rc := FileRebootChecker{FilePath: sentinel}
+	if got, err := rc.RebootRequired(); err != nil || got.Required {
+		t.Errorf("RebootRequired() = %+v, %v without sentinel, want no reboot", got, err)
+	}
+
+	if err := os.WriteFile(sentinel, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rc.RebootRequired(); err != nil || !got.Required || got.Reason == "" {
+		t.Errorf("RebootRequired() = %+v, %v with sentinel, want a reboot with a reason", got, err)
+	}
+}
+
+func TestFileRebootCheckerPackages(t *testing.T) {
+	dir := t.TempDir()
+	sentinel := filepath.Join(dir, "reboot-required")
+	if err := os.WriteFile(sentinel, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, _ := NewFileRebootChecker(sentinel, WithPackages())
+	if got, err := rc.RebootRequired(); err != nil || !got.Required || got.Details != nil {
+		t.Errorf("RebootRequired() = %+v, %v without packages file, want a reboot without details", got, err)
+	}
+
+	if err := os.WriteFile(sentinel+PackagesSuffix, []byte("linux-image-6.8.0-45-generic\nlibc6\nlinux-image-6.8.0-45-generic\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := rc.RebootRequired()
+	if err != nil || !got.Required {
+		t.Fatalf("RebootRequired() = %+v, %v with packages file, want a reboot", got, err)
+	}
+	if want := []string{"linux-image-6.8.0-45-generic", "libc6"}; !reflect.DeepEqual(got.Details, want) {
+		t.Errorf("RebootRequired() details = %v, want %v", got.Details, want)
+	}
+}
+
+func TestCommandCheckerTimeout(t *testing.T) {
+	// The background sleep keeps stdout open: it must be killed with the shell
+	cc, err := NewCommandChecker("sh -c 'sleep 30 & sleep 30'", 1, false, WithCommandTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	got, err := cc.RebootRequired()
+	if !errors.Is(err, ErrCommandTimeout) {
+		t.Errorf("RebootRequired() error = %v, want %v", err, ErrCommandTimeout)
+	}
+	if got.Required {
+		t.Errorf("RebootRequired() = %+v, want no reboot on timeout", got)
+	}
+	if elapsed := time.Since(start); elapsed > commandWaitDelay {
+		t.Errorf("RebootRequired() took %v, want the command and its children killed", elapsed)
+	}
+}
+
+func TestCommandCheckerMaxOutput(t *testing.T) {
+	cc, err := NewCommandChecker("sh -c 'printf 0123456789; exit 2'", 1, false, WithCommandMaxOutput(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err := cc.run(cc.MaxOutput)
+	if err == nil {
+		t.Fatal("run() expected an error for exit code 2")
+	}
+	if stdout.String() != "0123... (truncated)" || !strings.Contains(err.Error(), `stdout: "0123... (truncated)"`) {
+		t.Errorf("run() stdout = %q, error = %v, want stdout truncated to 4 bytes", stdout.String(), err)
+	}
+}
+
+func TestCommandCheckerParsedOutput(t *testing.T) {
+	// The output to parse is not limited by MaxOutput
+	cc := newCommandChecker([]string{"printf", "0123456789"}, 1, false, WithCommandMaxOutput(4))
+	output, err := cc.output()
+	if err != nil || string(output) != "0123456789" {
+		t.Errorf("output() = %q, %v, want the whole output", output, err)
+	}
+
+	cc = newCommandChecker([]string{"head", "-c", strconv.Itoa(commandMaxParsedOutput + 1), "/dev/zero"}, 1, false)
+	if _, err := cc.output(); err == nil {
+		t.Errorf("output() expected an error for an output exceeding %d bytes", commandMaxParsedOutput)
+	}
+}
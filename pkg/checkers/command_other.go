@@ -0,0 +1,11 @@
+//go:build !linux
+
+package checkers
+
+import (
+	"os/exec"
+)
+
+// killProcessGroupOnCancel keeps the default cancellation outside of linux:
+// only the command itself is killed.
+func killProcessGroupOnCancel(*exec.Cmd) {}
@@ -0,0 +1,82 @@
+package checkers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Modes of the CompositeChecker, defining how the results of its checkers are combined.
+const (
+	// ModeAny requires a reboot as soon as one of the checkers requires it
+	ModeAny = "any"
+	// ModeAll requires a reboot only when all the checkers require it
+	ModeAll = "all"
+)
+
+// NamedChecker is a Checker with a name, used to report which checkers require a reboot.
+type NamedChecker struct {
+	Name string
+	Checker
+}
+
+// CompositeChecker combines the results of several checkers,
+// with any (OR) or all (AND) semantics.
+type CompositeChecker struct {
+	Checkers []NamedChecker
+	Mode     string
+}
+
+// NewCompositeChecker is the constructor for the composite checker.
+// It validates the mode, and requires at least one checker.
+func NewCompositeChecker(mode string, checkers ...NamedChecker) (*CompositeChecker, error) {
+	if mode != ModeAny && mode != ModeAll {
+		return nil, fmt.Errorf("invalid reboot checker mode %s, expected %s or %s", mode, ModeAny, ModeAll)
+	}
+	if len(checkers) == 0 {
+		return nil, fmt.Errorf("composite reboot checker requires at least one checker")
+	}
+	return &CompositeChecker{
+		Checkers: checkers,
+		Mode:     mode,
+	}, nil
+}
+
+// RebootRequired runs all the checkers, and combines their results according to the mode.
+// The reasons and details of the checkers requiring a reboot are merged, prefixed with their name.
+// Failed checks only make the result fail when the other checkers cannot decide it: in any mode
+// when no checker requires a reboot, in all mode when no checker rules the reboot out.
+func (cc CompositeChecker) RebootRequired() (Result, error) {
+	var reasons, details []string
+	var errs []error
+	required := 0
+	for _, checker := range cc.Checkers {
+		result, err := checker.RebootRequired()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", checker.Name, err))
+			continue
+		}
+		if result.Required {
+			required++
+			reasons = append(reasons, fmt.Sprintf("%s: %s", checker.Name, result.Reason))
+			details = append(details, result.Details...)
+		}
+	}
+
+	err := errors.Join(errs...)
+	if required == len(cc.Checkers) || (cc.Mode == ModeAny && required > 0) {
+		if err != nil {
+			log.Warnf("Ignoring failed reboot checks: %v", err)
+		}
+		return Result{Required: true, Reason: strings.Join(reasons, "; "), Details: details}, nil
+	}
+	if err != nil && (cc.Mode == ModeAny || required+len(errs) == len(cc.Checkers)) {
+		return Result{}, err
+	}
+	if err != nil {
+		log.Warnf("Ignoring failed reboot checks: %v", err)
+	}
+	return Result{}, nil
+}
@@ -0,0 +1,64 @@
+package checkers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type staticChecker struct {
+	result Result
+	err    error
+}
+
+func (sc staticChecker) RebootRequired() (Result, error) {
+	return sc.result, sc.err
+}
+
+func TestCompositeChecker(t *testing.T) {
+	required := NamedChecker{Name: "required", Checker: staticChecker{result: Result{Required: true, Reason: "needed", Details: []string{"kernel"}}}}
+	notRequired := NamedChecker{Name: "not-required", Checker: staticChecker{}}
+	failing := NamedChecker{Name: "failing", Checker: staticChecker{err: errors.New("broken")}}
+
+	tests := []struct {
+		name     string
+		mode     string
+		checkers []NamedChecker
+		want     Result
+		wantErr  bool
+	}{
+		{"any with one required", ModeAny, []NamedChecker{notRequired, required}, Result{Required: true, Reason: "required: needed", Details: []string{"kernel"}}, false},
+		{"any with none required", ModeAny, []NamedChecker{notRequired, notRequired}, Result{}, false},
+		{"any with one required and one failing", ModeAny, []NamedChecker{failing, required}, Result{Required: true, Reason: "required: needed", Details: []string{"kernel"}}, false},
+		{"any with none required and one failing", ModeAny, []NamedChecker{failing, notRequired}, Result{}, true},
+		{"all with one required", ModeAll, []NamedChecker{notRequired, required}, Result{}, false},
+		{"all with all required", ModeAll, []NamedChecker{required, required}, Result{Required: true, Reason: "required: needed; required: needed", Details: []string{"kernel", "kernel"}}, false},
+		{"all with one not required and one failing", ModeAll, []NamedChecker{failing, notRequired}, Result{}, false},
+		{"all with one required and one failing", ModeAll, []NamedChecker{failing, required}, Result{}, true},
+		{"single checker", ModeAll, []NamedChecker{required}, Result{Required: true, Reason: "required: needed", Details: []string{"kernel"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc, err := NewCompositeChecker(tt.mode, tt.checkers...)
+			if err != nil {
+				t.Fatalf("NewCompositeChecker() error = %v", err)
+			}
+			got, err := cc.RebootRequired()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RebootRequired() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RebootRequired() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCompositeCheckerErrors(t *testing.T) {
+	if _, err := NewCompositeChecker("some", NamedChecker{Name: "file", Checker: staticChecker{}}); err == nil {
+		t.Errorf("expected an error for an invalid mode")
+	}
+	if _, err := NewCompositeChecker(ModeAny); err == nil {
+		t.Errorf("expected an error without checkers")
+	}
+}
@@ -0,0 +1,94 @@
+package checkers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeConditionMatch is a node condition type, with the status in which it requires a reboot.
+type NodeConditionMatch struct {
+	Type   v1.NodeConditionType
+	Status v1.ConditionStatus
+}
+
+// NodeConditionChecker requires a reboot when the node has one of the given conditions in
+// the given status, allowing to act on the signals of other agents such as node-problem-detector.
+type NodeConditionChecker struct {
+	// client used to contact kubernetes API
+	client     *kubernetes.Clientset
+	nodeName   string
+	conditions []NodeConditionMatch
+}
+
+// NewNodeConditionChecker is the constructor for the node condition checker.
+func NewNodeConditionChecker(client *kubernetes.Clientset, nodename string, conditions []NodeConditionMatch) (*NodeConditionChecker, error) {
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("node condition reboot checker requires at least one condition")
+	}
+	return &NodeConditionChecker{
+		client:     client,
+		nodeName:   nodename,
+		conditions: conditions,
+	}, nil
+}
+
+// ParseNodeConditions parses node conditions given as Type or Type=Status,
+// the status defaulting to True.
+func ParseNodeConditions(specs []string) ([]NodeConditionMatch, error) {
+	var conditions []NodeConditionMatch
+	for _, spec := range specs {
+		conditionType, status, found := strings.Cut(spec, "=")
+		if !found {
+			status = string(v1.ConditionTrue)
+		}
+		if conditionType == "" {
+			return nil, fmt.Errorf("invalid node condition %q, expected Type or Type=Status", spec)
+		}
+		switch v1.ConditionStatus(status) {
+		case v1.ConditionTrue, v1.ConditionFalse, v1.ConditionUnknown:
+		default:
+			return nil, fmt.Errorf("invalid status %s in node condition %q, expected %s, %s or %s", status, spec, v1.ConditionTrue, v1.ConditionFalse, v1.ConditionUnknown)
+		}
+		conditions = append(conditions, NodeConditionMatch{Type: v1.NodeConditionType(conditionType), Status: v1.ConditionStatus(status)})
+	}
+	return conditions, nil
+}
+
+// RebootRequired checks the conditions of the node.
+func (nc NodeConditionChecker) RebootRequired() (Result, error) {
+	node, err := nc.client.CoreV1().Nodes().Get(context.TODO(), nc.nodeName, metav1.GetOptions{})
+	if err != nil {
+		return Result{}, fmt.Errorf("error retrieving node object via k8s API: %w", err)
+	}
+	return matchNodeConditions(node.Status.Conditions, nc.conditions), nil
+}
+
+// matchNodeConditions requires a reboot when any of the node conditions matches,
+// with the reasons and messages of the matching conditions as reason.
+func matchNodeConditions(nodeConditions []v1.NodeCondition, matches []NodeConditionMatch) Result {
+	var reasons []string
+	for _, condition := range nodeConditions {
+		for _, match := range matches {
+			if condition.Type != match.Type || condition.Status != match.Status {
+				continue
+			}
+			reason := fmt.Sprintf("node condition %s is %s", condition.Type, condition.Status)
+			if condition.Reason != "" {
+				reason = fmt.Sprintf("%s: %s", reason, condition.Reason)
+			}
+			if condition.Message != "" {
+				reason = fmt.Sprintf("%s: %s", reason, condition.Message)
+			}
+			reasons = append(reasons, reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return Result{}
+	}
+	return Result{Required: true, Reason: strings.Join(reasons, "; ")}
+}
@@ -0,0 +1,68 @@
+package checkers
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestParseNodeConditions(t *testing.T) {
+	got, err := ParseNodeConditions([]string{"RebootRequired", "KernelDeadlock=Unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []NodeConditionMatch{
+		{Type: "RebootRequired", Status: v1.ConditionTrue},
+		{Type: "KernelDeadlock", Status: v1.ConditionUnknown},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseNodeConditions() = %v, want %v", got, want)
+	}
+
+	for _, spec := range []string{"=True", "RebootRequired=Yes", "RebootRequired="} {
+		if _, err := ParseNodeConditions([]string{spec}); err == nil {
+			t.Errorf("ParseNodeConditions(%q) expected an error", spec)
+		}
+	}
+}
+
+func TestMatchNodeConditions(t *testing.T) {
+	matches := []NodeConditionMatch{
+		{Type: "RebootRequired", Status: v1.ConditionTrue},
+		{Type: "KernelDeadlock", Status: v1.ConditionTrue},
+	}
+	tests := []struct {
+		name       string
+		conditions []v1.NodeCondition
+		want       Result
+	}{
+		{
+			name: "no matching condition",
+			conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue},
+				{Type: "KernelDeadlock", Status: v1.ConditionFalse, Reason: "KernelHasNoDeadlock"},
+			},
+			want: Result{},
+		},
+		{
+			name: "matching conditions",
+			conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue},
+				{Type: "RebootRequired", Status: v1.ConditionTrue, Reason: "PackagesUpdated"},
+				{Type: "KernelDeadlock", Status: v1.ConditionTrue, Reason: "DockerHung", Message: "task docker:7 blocked for more than 120 seconds."},
+			},
+			want: Result{
+				Required: true,
+				Reason:   "node condition RebootRequired is True: PackagesUpdated; node condition KernelDeadlock is True: DockerHung: task docker:7 blocked for more than 120 seconds.",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchNodeConditions(tt.conditions, matches); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matchNodeConditions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package checkers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// RpmOstreeChecker requires a reboot when rpm-ostree, e.g. on Fedora CoreOS, has a deployment
+// staged or pending for the next boot, as reported by rpm-ostree status --json.
+type RpmOstreeChecker struct {
+	CommandChecker
+}
+
+// NewRpmOstreeChecker is the constructor for the rpm-ostree checker, running the rpm-ostree
+// binary found at rpmOstreePath, wrapped with nsenter when privileged like the CommandChecker.
+func NewRpmOstreeChecker(rpmOstreePath string, pid int, privileged bool, opts ...CommandOption) (*RpmOstreeChecker, error) {
+	if rpmOstreePath == "" {
+		return nil, fmt.Errorf("rpm-ostree checker requires the path of rpm-ostree")
+	}
+	return &RpmOstreeChecker{
+		CommandChecker: *newCommandChecker([]string{rpmOstreePath, "status", "--json"}, pid, privileged, opts...),
+	}, nil
+}
+
+// rpmOstreeStatus is the part of the output of rpm-ostree status --json used by the checker.
+type rpmOstreeStatus struct {
+	Deployments []rpmOstreeDeployment `json:"deployments"`
+}
+
+type rpmOstreeDeployment struct {
+	Checksum string `json:"checksum"`
+	Version  string `json:"version"`
+	Booted   bool   `json:"booted"`
+	Staged   bool   `json:"staged"`
+}
+
+// name identifies the deployment by its version, falling back to its checksum.
+func (d rpmOstreeDeployment) name() string {
+	if d.Version != "" {
+		return d.Version
+	}
+	return d.Checksum
+}
+
+// RebootRequired runs rpm-ostree status, and parses its output.
+func (rc RpmOstreeChecker) RebootRequired() (Result, error) {
+	output, err := rc.output()
+	if err != nil {
+		return Result{}, err
+	}
+	return parseRpmOstreeStatus(output)
+}
+
+// parseRpmOstreeStatus requires a reboot when a deployment is staged, to be finalized on shutdown,
+// or when the first deployment, the one booted next, is not the booted one.
+func parseRpmOstreeStatus(output []byte) (Result, error) {
+	var status rpmOstreeStatus
+	if err := json.Unmarshal(output, &status); err != nil {
+		return Result{}, fmt.Errorf("error parsing rpm-ostree status: %w", err)
+	}
+	if len(status.Deployments) == 0 {
+		return Result{}, fmt.Errorf("error parsing rpm-ostree status: no deployment")
+	}
+	for _, deployment := range status.Deployments {
+		if deployment.Staged {
+			return Result{Required: true, Reason: fmt.Sprintf("rpm-ostree deployment %s is staged", deployment.name())}, nil
+		}
+	}
+	if next := status.Deployments[0]; !next.Booted {
+		return Result{Required: true, Reason: fmt.Sprintf("rpm-ostree deployment %s is pending", next.name())}, nil
+	}
+	return Result{}, nil
+}
+
+// TransactionalUpdateChecker requires a reboot when transactional-update, e.g. on openSUSE MicroOS,
+// made a new snapshot the default for the next boot, as reported by snapper. The default snapshot
+// then differs from the active one.
+type TransactionalUpdateChecker struct {
+	CommandChecker
+}
+
+// NewTransactionalUpdateChecker is the constructor for the transactional-update checker, running
+// the snapper binary found at snapperPath, wrapped with nsenter when privileged like the CommandChecker.
+func NewTransactionalUpdateChecker(snapperPath string, pid int, privileged bool, opts ...CommandOption) (*TransactionalUpdateChecker, error) {
+	if snapperPath == "" {
+		return nil, fmt.Errorf("transactional-update checker requires the path of snapper")
+	}
+	return &TransactionalUpdateChecker{
+		CommandChecker: *newCommandChecker([]string{snapperPath, "--csvout", "list", "--columns", "number,default,active,description"}, pid, privileged, opts...),
+	}, nil
+}
+
+// RebootRequired runs snapper list, and parses its output.
+func (tc TransactionalUpdateChecker) RebootRequired() (Result, error) {
+	output, err := tc.output()
+	if err != nil {
+		return Result{}, err
+	}
+	return parseSnapperList(output)
+}
+
+// parseSnapperList requires a reboot when the default snapshot is not the active one.
+// The output is the CSV of snapper list, with the number, default, active and description columns.
+func parseSnapperList(output []byte) (Result, error) {
+	reader := csv.NewReader(bytes.NewReader(output))
+	header, err := reader.Read()
+	if err != nil {
+		return Result{}, fmt.Errorf("error parsing snapper list: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[column] = i
+	}
+	for _, column := range []string{"number", "default", "active", "description"} {
+		if _, ok := columns[column]; !ok {
+			return Result{}, fmt.Errorf("error parsing snapper list: missing column %s", column)
+		}
+	}
+
+	var defaultSnapshot, activeSnapshot []string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Result{}, fmt.Errorf("error parsing snapper list: %w", err)
+		}
+		if record[columns["default"]] == "yes" {
+			defaultSnapshot = record
+		}
+		if record[columns["active"]] == "yes" {
+			activeSnapshot = record
+		}
+	}
+	if defaultSnapshot == nil || activeSnapshot == nil {
+		return Result{}, fmt.Errorf("error parsing snapper list: default or active snapshot not found")
+	}
+	if defaultSnapshot[columns["number"]] == activeSnapshot[columns["number"]] {
+		return Result{}, nil
+	}
+	snapshot := defaultSnapshot[columns["number"]]
+	if description := strings.TrimSpace(defaultSnapshot[columns["description"]]); description != "" {
+		snapshot = fmt.Sprintf("%s (%s)", snapshot, description)
+	}
+	return Result{Required: true, Reason: fmt.Sprintf("transactional-update snapshot %s is the default for the next boot", snapshot)}, nil
+}
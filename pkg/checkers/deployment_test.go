@@ -0,0 +1,114 @@
+package checkers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseRpmOstreeStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    bool
+		reason  string
+		wantErr bool
+	}{
+		{
+			name: "Ensure the booted deployment does not require a reboot",
+			file: "testdata/rpm-ostree/booted.json",
+		},
+		{
+			name:   "Ensure a staged deployment requires a reboot",
+			file:   "testdata/rpm-ostree/staged.json",
+			want:   true,
+			reason: "rpm-ostree deployment 40.20240906.3.0 is staged",
+		},
+		{
+			name:   "Ensure a pending deployment requires a reboot",
+			file:   "testdata/rpm-ostree/pending.json",
+			want:   true,
+			reason: "rpm-ostree deployment 9a8b7c6d5e4f30211a2b3c4d5e6f70819a8b7c6d5e4f30211a2b3c4d5e6f7081 is pending",
+		},
+		{
+			name:    "Ensure an unexpected output is an error",
+			file:    "testdata/snapper/active.csv",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseRpmOstreeStatus(output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRpmOstreeStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Required != tt.want || got.Reason != tt.reason {
+				t.Errorf("parseRpmOstreeStatus() = %+v, want %v with reason %q", got, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestParseSnapperList(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    bool
+		reason  string
+		wantErr bool
+	}{
+		{
+			name: "Ensure the active default snapshot does not require a reboot",
+			file: "testdata/snapper/active.csv",
+		},
+		{
+			name:   "Ensure a new default snapshot requires a reboot",
+			file:   "testdata/snapper/updated.csv",
+			want:   true,
+			reason: "transactional-update snapshot 4 (Snapshot Update of #3, dup) is the default for the next boot",
+		},
+		{
+			name:    "Ensure an unexpected output is an error",
+			file:    "testdata/rpm-ostree/booted.json",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseSnapperList(output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSnapperList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Required != tt.want || got.Reason != tt.reason {
+				t.Errorf("parseSnapperList() = %+v, want %v with reason %q", got, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestRpmOstreeChecker(t *testing.T) {
+	status, err := filepath.Abs("testdata/rpm-ostree/staged.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpmOstree := filepath.Join(t.TempDir(), "rpm-ostree")
+	if err := os.WriteFile(rpmOstree, []byte("#!/bin/sh\ncat "+status+"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := NewRpmOstreeChecker(rpmOstree, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rc.RebootRequired(); err != nil || !got.Required {
+		t.Errorf("RebootRequired() = %+v, %v, want a reboot", got, err)
+	}
+}
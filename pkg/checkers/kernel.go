@@ -0,0 +1,203 @@
+package checkers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultOSReleasePath is the file containing the release of the running kernel.
+// The kernel is shared by all the containers, so it does not need to be read from the host.
+const DefaultOSReleasePath = "/proc/sys/kernel/osrelease"
+
+// KernelChecker requires a reboot when a kernel newer than the running
+// kernel is installed on the host, under /lib/modules or /boot. Only the
+// kernels of the same flavour as the running kernel are considered.
+type KernelChecker struct {
+	// HostRoot is the path of the host root filesystem, e.g. /proc/1/root
+	HostRoot string
+	// OSReleasePath is the file containing the release of the running kernel
+	OSReleasePath string
+}
+
+// NewKernelChecker is the constructor for the kernel checker, looking
+// for installed kernels in the host root filesystem mounted at hostRoot.
+func NewKernelChecker(hostRoot string) (*KernelChecker, error) {
+	if hostRoot == "" {
+		return nil, fmt.Errorf("kernel checker requires the path of the host root filesystem")
+	}
+	return &KernelChecker{
+		HostRoot:      hostRoot,
+		OSReleasePath: DefaultOSReleasePath,
+	}, nil
+}
+
+// RebootRequired compares the running kernel release to the newest installed kernel release
+// of the same flavour.
+func (kc KernelChecker) RebootRequired() (Result, error) {
+	running, err := os.ReadFile(kc.OSReleasePath)
+	if err != nil {
+		return Result{}, fmt.Errorf("error reading running kernel release: %w", err)
+	}
+	runningRelease := strings.TrimSpace(string(running))
+
+	releases, err := kc.installedReleases()
+	if err != nil {
+		return Result{}, err
+	}
+	// Kernels of other flavours, e.g. -cloud-amd64 next to -amd64, are not the ones booted next
+	var installed []string
+	for _, release := range releases {
+		if kernelFlavour(release) == kernelFlavour(runningRelease) {
+			installed = append(installed, release)
+		}
+	}
+	if len(installed) == 0 {
+		return Result{}, fmt.Errorf("no installed kernel of the running kernel flavour found under %s", kc.HostRoot)
+	}
+	newest := installed[0]
+	for _, release := range installed[1:] {
+		if compareKernelReleases(release, newest) > 0 {
+			newest = release
+		}
+	}
+
+	if compareKernelReleases(newest, runningRelease) <= 0 {
+		return Result{}, nil
+	}
+	return Result{Required: true, Reason: fmt.Sprintf("running kernel %s, newest installed kernel %s", runningRelease, newest)}, nil
+}
+
+// installedReleases lists the kernel releases installed on the host: the /lib/modules
+// directories whose modules were indexed, and the /boot kernel images.
+func (kc KernelChecker) installedReleases() ([]string, error) {
+	var releases []string
+
+	modulesDir := filepath.Join(kc.HostRoot, "lib", "modules")
+	entries, err := os.ReadDir(modulesDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error listing installed kernels: %w", err)
+	}
+	for _, entry := range entries {
+		// modules.dep is generated once the kernel is fully installed, and removed with it
+		if _, err := os.Stat(filepath.Join(modulesDir, entry.Name(), "modules.dep")); err == nil {
+			releases = append(releases, entry.Name())
+		}
+	}
+
+	entries, err = os.ReadDir(filepath.Join(kc.HostRoot, "boot"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error listing installed kernels: %w", err)
+	}
+	for _, entry := range entries {
+		for _, prefix := range []string{"vmlinuz-", "vmlinux-"} {
+			if release, found := strings.CutPrefix(entry.Name(), prefix); found && !entry.IsDir() {
+				releases = append(releases, trimCompressionSuffix(release))
+			}
+		}
+	}
+	return releases, nil
+}
+
+// trimCompressionSuffix removes the extension of compressed kernel images, such as
+// the /boot/vmlinux-<release>.gz of openSUSE and SLES, to get their release.
+func trimCompressionSuffix(release string) string {
+	for _, suffix := range []string{".gz", ".xz", ".zst"} {
+		if trimmed, found := strings.CutSuffix(release, suffix); found {
+			return trimmed
+		}
+	}
+	return release
+}
+
+// kernelFlavour returns the flavour of a kernel release: its trailing dash separated components
+// starting with a letter, such as generic in 6.8.0-45-generic or cloud-amd64 in 6.1.0-26-cloud-amd64,
+// or its + suffix, such as +rt in 5.14.0-427.13.1.el9_4.x86_64+rt. Releases ending with a
+// number or a release candidate, such as 5.14.0-503.11.1.el9_5.x86_64, 6.10.3-arch1-1 or
+// 6.12.0-rc3, have no flavour.
+func kernelFlavour(release string) string {
+	if plus := strings.LastIndex(release, "+"); plus > strings.LastIndex(release, "-") {
+		return release[plus:]
+	}
+	components := strings.Split(release, "-")
+	start := len(components)
+	for start > 1 && isFlavourComponent(components[start-1]) {
+		start--
+	}
+	return strings.Join(components[start:], "-")
+}
+
+func isFlavourComponent(component string) bool {
+	if component == "" || !unicode.IsLetter(rune(component[0])) {
+		return false
+	}
+	if number, found := strings.CutPrefix(component, "rc"); found {
+		if _, err := strconv.ParseUint(number, 10, 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// compareKernelReleases compares two kernel releases segment by segment, like package
+// managers do: numeric segments are compared as numbers, other segments as strings.
+// It returns a negative number when a is older than b, 0 when they are equal, and a
+// positive number when a is newer than b.
+func compareKernelReleases(a, b string) int {
+	segmentsA, segmentsB := releaseSegments(a), releaseSegments(b)
+	for i := 0; i < len(segmentsA) && i < len(segmentsB); i++ {
+		segmentA, segmentB := segmentsA[i], segmentsB[i]
+		numberA, errA := strconv.ParseUint(segmentA, 10, 64)
+		numberB, errB := strconv.ParseUint(segmentB, 10, 64)
+		switch {
+		case errA == nil && errB == nil:
+			if numberA != numberB {
+				if numberA < numberB {
+					return -1
+				}
+				return 1
+			}
+		case errA == nil:
+			// Numbers are newer than letters, e.g. 5.14.0-1 is newer than 5.14.0-rc1
+			return 1
+		case errB == nil:
+			return -1
+		default:
+			if cmp := strings.Compare(segmentA, segmentB); cmp != 0 {
+				return cmp
+			}
+		}
+	}
+	return len(segmentsA) - len(segmentsB)
+}
+
+// releaseSegments splits a release into its numeric and alphabetic segments, dropping the separators.
+func releaseSegments(release string) []string {
+	var segments []string
+	start := -1
+	for i, r := range release {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if start >= 0 {
+				segments = append(segments, release[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start >= 0 && unicode.IsDigit(r) != unicode.IsDigit(rune(release[start])) {
+			segments = append(segments, release[start:i])
+			start = -1
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		segments = append(segments, release[start:])
+	}
+	return segments
+}
@@ -0,0 +1,143 @@
+package checkers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKernelChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostRoot string
+		running  string
+		want     bool
+		reason   string
+		wantErr  bool
+	}{
+		{
+			name:     "Ensure an older running kernel requires a reboot",
+			hostRoot: "testdata/kernel/debian",
+			running:  "6.1.0-25-amd64",
+			want:     true,
+			reason:   "running kernel 6.1.0-25-amd64, newest installed kernel 6.1.0-26-amd64",
+		},
+		{
+			name:     "Ensure the newest running kernel does not require a reboot",
+			hostRoot: "testdata/kernel/debian",
+			running:  "6.1.0-26-amd64",
+		},
+		{
+			name:     "Ensure a running kernel newer than the installed ones does not require a reboot",
+			hostRoot: "testdata/kernel/debian",
+			running:  "6.1.0-28-amd64",
+		},
+		{
+			name:     "Ensure kernels are found in /boot",
+			hostRoot: "testdata/kernel/boot-only",
+			running:  "5.14.0-427.13.1.el9_4.x86_64",
+			want:     true,
+			reason:   "running kernel 5.14.0-427.13.1.el9_4.x86_64, newest installed kernel 5.14.0-503.11.1.el9_5.x86_64",
+		},
+		{
+			name:     "Ensure compressed kernel images do not require a reboot",
+			hostRoot: "testdata/kernel/suse",
+			running:  "6.4.0-150600.23.25-default",
+		},
+		{
+			name:     "Ensure compressed kernel images are compared by release",
+			hostRoot: "testdata/kernel/suse",
+			running:  "6.4.0-150600.23.22-default",
+			want:     true,
+			reason:   "running kernel 6.4.0-150600.23.22-default, newest installed kernel 6.4.0-150600.23.25-default",
+		},
+		{
+			name:     "Ensure kernels of another flavour do not require a reboot",
+			hostRoot: "testdata/kernel/flavours",
+			running:  "6.1.0-26-amd64",
+		},
+		{
+			name:     "Ensure kernels are compared within the running kernel flavour",
+			hostRoot: "testdata/kernel/flavours",
+			running:  "6.1.0-26-cloud-amd64",
+			want:     true,
+			reason:   "running kernel 6.1.0-26-cloud-amd64, newest installed kernel 6.1.0-27-cloud-amd64",
+		},
+		{
+			name:     "Ensure no installed kernel is an error",
+			hostRoot: "testdata/kernel/empty",
+			running:  "6.1.0-26-amd64",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			osRelease := filepath.Join(t.TempDir(), "osrelease")
+			if err := os.WriteFile(osRelease, []byte(tt.running+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			kc, err := NewKernelChecker(tt.hostRoot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kc.OSReleasePath = osRelease
+
+			got, err := kc.RebootRequired()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RebootRequired() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Required != tt.want || got.Reason != tt.reason {
+				t.Errorf("RebootRequired() = %+v, want required %v with reason %q", got, tt.want, tt.reason)
+			}
+		})
+	}
+}
+
+func TestCompareKernelReleases(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"6.8.0-45-generic", "6.8.0-45-generic", 0},
+		{"6.8.0-45-generic", "6.8.0-100-generic", -1},
+		{"6.10.1", "6.9.12", 1},
+		{"5.14.0-503.11.1.el9_5.x86_64", "5.14.0-427.13.1.el9_4.x86_64", 1},
+		{"6.1.0-rc1", "6.1.0-1", -1},
+		{"6.1.0", "6.1.0-1", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			got := compareKernelReleases(tt.a, tt.b)
+			if (got < 0 && tt.want >= 0) || (got == 0 && tt.want != 0) || (got > 0 && tt.want <= 0) {
+				t.Errorf("compareKernelReleases(%q, %q) = %d, want sign of %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKernelFlavour(t *testing.T) {
+	tests := []struct {
+		release string
+		want    string
+	}{
+		{"6.1.0-26-amd64", "amd64"},
+		{"6.1.0-26-cloud-amd64", "cloud-amd64"},
+		{"6.8.0-45-generic", "generic"},
+		{"6.8.0-45-lowlatency", "lowlatency"},
+		{"6.4.0-150600.23.25-default", "default"},
+		{"6.6.44-1-lts", "lts"},
+		{"6.10.3-arch1-1", ""},
+		{"5.14.0-503.11.1.el9_5.x86_64", ""},
+		{"5.14.0-427.13.1.el9_4.x86_64+rt", "+rt"},
+		{"6.6.31+rpt-rpi-v8", "rpi-v8"},
+		{"6.10.1", ""},
+		{"6.12.0-rc3", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.release, func(t *testing.T) {
+			if got := kernelFlavour(tt.release); got != tt.want {
+				t.Errorf("kernelFlavour(%q) = %q, want %q", tt.release, got, tt.want)
+			}
+		})
+	}
+}
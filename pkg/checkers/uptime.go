@@ -0,0 +1,60 @@
+package checkers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultUptimePath is the file containing the uptime of the host, in seconds.
+// The uptime is the one of the kernel, shared by all the containers.
+const DefaultUptimePath = "/proc/uptime"
+
+// UptimeChecker requires a reboot when the host has been up for longer than MaxUptime,
+// forcing periodic reboots even when no update requires one.
+type UptimeChecker struct {
+	MaxUptime  time.Duration
+	UptimePath string
+}
+
+// NewUptimeChecker is the constructor for the uptime checker.
+func NewUptimeChecker(maxUptime time.Duration) (*UptimeChecker, error) {
+	if maxUptime <= 0 {
+		return nil, fmt.Errorf("invalid maximum uptime %v, expected a positive duration", maxUptime)
+	}
+	return &UptimeChecker{
+		MaxUptime:  maxUptime,
+		UptimePath: DefaultUptimePath,
+	}, nil
+}
+
+// RebootRequired compares the uptime of the host to the maximum uptime.
+func (uc UptimeChecker) RebootRequired() (Result, error) {
+	uptime, err := readUptime(uc.UptimePath)
+	if err != nil {
+		return Result{}, err
+	}
+	if uptime <= uc.MaxUptime {
+		return Result{}, nil
+	}
+	return Result{Required: true, Reason: fmt.Sprintf("uptime %v exceeds maximum uptime %v", uptime.Round(time.Minute), uc.MaxUptime)}, nil
+}
+
+// readUptime parses the first field of /proc/uptime: the seconds elapsed since boot.
+func readUptime(path string) (time.Duration, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading uptime: %w", err)
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("error parsing uptime: %s is empty", path)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing uptime: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
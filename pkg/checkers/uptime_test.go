@@ -0,0 +1,60 @@
+package checkers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUptimeChecker(t *testing.T) {
+	tests := []struct {
+		name    string
+		uptime  string
+		want    bool
+		reason  string
+		wantErr bool
+	}{
+		{
+			name:   "Ensure an uptime above the maximum requires a reboot",
+			uptime: "2595600.42 10236543.21\n",
+			want:   true,
+			reason: "uptime 721h0m0s exceeds maximum uptime 720h0m0s",
+		},
+		{
+			name:   "Ensure an uptime below the maximum does not require a reboot",
+			uptime: "86400.00 345600.00\n",
+		},
+		{
+			name:    "Ensure an empty uptime is an error",
+			uptime:  "",
+			wantErr: true,
+		},
+		{
+			name:    "Ensure an invalid uptime is an error",
+			uptime:  "up 3 days\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uptimePath := filepath.Join(t.TempDir(), "uptime")
+			if err := os.WriteFile(uptimePath, []byte(tt.uptime), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			uc, err := NewUptimeChecker(720 * time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uc.UptimePath = uptimePath
+
+			got, err := uc.RebootRequired()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RebootRequired() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Required != tt.want || got.Reason != tt.reason {
+				t.Errorf("RebootRequired() = %+v, want required %v with reason %q", got, tt.want, tt.reason)
+			}
+		})
+	}
+}
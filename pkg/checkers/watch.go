@@ -0,0 +1,66 @@
+package checkers
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrWatchUnsupported is returned by Watch when changes cannot be watched,
+// in which case the checker can only be polled.
+var ErrWatchUnsupported = errors.New("watching reboot checker changes is not supported")
+
+// Watcher is implemented by the checkers which can notify that their result
+// might have changed, so that they are checked immediately instead of on the
+// next poll.
+type Watcher interface {
+	// Watch notifies on the returned channel when the result might have changed,
+	// until ctx ends, after which the channel is closed.
+	Watch(ctx context.Context) (<-chan struct{}, error)
+}
+
+// notify sends a notification without blocking: pending notifications are coalesced.
+func notify(c chan<- struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// Watch merges the notifications of the checkers which can be watched.
+// Checkers which cannot be watched are only polled.
+func (cc CompositeChecker) Watch(ctx context.Context) (<-chan struct{}, error) {
+	var watches []<-chan struct{}
+	for _, checker := range cc.Checkers {
+		watcher, ok := checker.Checker.(Watcher)
+		if !ok {
+			continue
+		}
+		watch, err := watcher.Watch(ctx)
+		if err != nil {
+			log.Warnf("Unable to watch reboot checker %s, it will only be polled: %v", checker.Name, err)
+			continue
+		}
+		watches = append(watches, watch)
+	}
+	if len(watches) == 0 {
+		return nil, ErrWatchUnsupported
+	}
+
+	merged := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	for _, watch := range watches {
+		wg.Go(func() {
+			for range watch {
+				notify(merged)
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged, nil
+}
@@ -0,0 +1,68 @@
+//go:build linux
+
+package checkers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sentinelEvents are the inotify events of the sentinel directory which can make the sentinel file appear or disappear
+const sentinelEvents = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// Watch notifies when the sentinel file appears or disappears, using inotify on its directory:
+// watching the directory instead of the file allows to watch a file which does not exist yet.
+func (rc FileRebootChecker) Watch(ctx context.Context) (<-chan struct{}, error) {
+	dir, name := filepath.Split(filepath.Clean(rc.FilePath))
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("error initialising inotify: %w", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, sentinelEvents); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("error watching sentinel directory %s: %w", dir, err)
+	}
+	// The non blocking file is handled by the runtime poller, so closing it interrupts the pending read
+	events := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-ctx.Done()
+		_ = events.Close()
+	}()
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		buf := make([]byte, 4096*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := events.Read(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Warnf("Stopped watching sentinel directory %s: %v", dir, err)
+				}
+				return
+			}
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameStart := offset + syscall.SizeofInotifyEvent
+				eventName := string(bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00"))
+				offset = nameStart + int(event.Len)
+
+				if event.Mask&syscall.IN_IGNORED != 0 {
+					log.Warnf("Stopped watching sentinel directory %s: directory removed", dir)
+					return
+				}
+				if eventName == name {
+					notify(changes)
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
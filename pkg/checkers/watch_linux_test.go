@@ -0,0 +1,89 @@
+//go:build linux
+
+package checkers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitNotification(t *testing.T, changes <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case _, ok := <-changes:
+		if !ok {
+			t.Fatalf("watch ended instead of notifying %s", what)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no notification after %s", what)
+	}
+}
+
+func TestFileRebootCheckerWatch(t *testing.T) {
+	dir := t.TempDir()
+	sentinel := filepath.Join(dir, "reboot-required")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rc := FileRebootChecker{FilePath: sentinel}
+	changes, err := rc.Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "other"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sentinel, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitNotification(t, changes, "creating the sentinel")
+
+	if err := os.Remove(sentinel); err != nil {
+		t.Fatal(err)
+	}
+	waitNotification(t, changes, "removing the sentinel")
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		for ok {
+			_, ok = <-changes
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watch not ended after cancelling its context")
+	}
+}
+
+func TestCompositeCheckerWatch(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cc, err := NewCompositeChecker(ModeAny,
+		NamedChecker{Name: "static", Checker: staticChecker{}},
+		NamedChecker{Name: "file", Checker: FileRebootChecker{FilePath: filepath.Join(dir, "reboot-required")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := cc.Watch(ctx)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "reboot-required"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitNotification(t, changes, "creating the sentinel")
+
+	static, err := NewCompositeChecker(ModeAny, NamedChecker{Name: "static", Checker: staticChecker{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := static.Watch(ctx); !errors.Is(err, ErrWatchUnsupported) {
+		t.Errorf("Watch() error = %v, want %v", err, ErrWatchUnsupported)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package checkers
+
+import (
+	"context"
+)
+
+// Watch is not supported outside of linux: the sentinel file can only be polled.
+func (rc FileRebootChecker) Watch(context.Context) (<-chan struct{}, error) {
+	return nil, ErrWatchUnsupported
+}
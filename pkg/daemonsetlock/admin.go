@@ -0,0 +1,252 @@
+package daemonsetlock
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Compile-time checks to ensure the types implement the interface
+var (
+	_ Admin = (*DaemonSetLock)(nil)
+	_ Admin = (*LeaseLock)(nil)
+)
+
+// Admin allows operators to inspect the lock, and to release it on behalf of any node.
+// All the modifications are done with optimistic concurrency: they are retried on
+// top of the latest version of the lock when someone else modified it meanwhile.
+type Admin interface {
+	// Holders returns all the nodes recorded in the lock, including the ones whose lock expired.
+	Holders(context.Context) ([]LockAnnotationValue, error)
+	// Waiters returns the nodes waiting in the lock queue.
+	Waiters(context.Context) ([]Waiter, error)
+	// ReleaseNode removes the lock entry of the given node.
+	ReleaseNode(ctx context.Context, nodeID string) error
+	// Clear removes all the lock entries.
+	Clear(context.Context) error
+	// History returns the last lock releases, oldest first.
+	History(context.Context) ([]HistoryEntry, error)
+}
+
+// NewDaemonSetAdmin creates an Admin for the locks stored in the kured ds annotation.
+func NewDaemonSetAdmin(client *kubernetes.Clientset, namespace, name, annotation string) Admin {
+	return &DaemonSetLock{
+		client:     client,
+		namespace:  namespace,
+		name:       name,
+		annotation: annotation,
+	}
+}
+
+// NewLeaseAdmin creates an Admin for the locks stored in the Leases named <leaseName>-<slot> in leaseNamespace.
+func NewLeaseAdmin(client kubernetes.Interface, leaseNamespace, leaseName, annotation string) Admin {
+	return &LeaseLock{
+		DaemonSetLock: DaemonSetLock{
+			client:     client,
+			annotation: annotation,
+		},
+		leaseNamespace: leaseNamespace,
+		leaseName:      leaseName,
+	}
+}
+
+// forcedHistorySize returns the size of the history when operators release locks:
+// they do not know the size configured on the nodes, so the history is not truncated
+// below DefaultHistorySize and the nodes apply their own size on their next release.
+func forcedHistorySize(history []HistoryEntry) int {
+	return max(len(history), DefaultHistorySize)
+}
+
+// forceRelease removes the lock entries of the nodes matching the given function,
+// recording them in the history, and returns how many entries were removed.
+func forceRelease(value *multiLockAnnotationValue, matches func(nodeID string) bool) int {
+	historySize := forcedHistorySize(value.History)
+	var kept []LockAnnotationValue
+	for _, holder := range value.LockAnnotations {
+		if matches(holder.NodeID) {
+			value.History = appendHistory(value.History, releaseEntry(holder, OutcomeForceReleased), historySize)
+			continue
+		}
+		kept = append(kept, holder)
+	}
+	released := len(value.LockAnnotations) - len(kept)
+	value.LockAnnotations = kept
+	return released
+}
+
+// Holders returns all the nodes recorded in the kured ds annotation.
+func (dsl *DaemonSetLock) Holders(ctx context.Context) ([]LockAnnotationValue, error) {
+	ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := dsl.readLockAnnotation(ds)
+	return value.LockAnnotations, err
+}
+
+// Waiters returns the nodes waiting in the queue recorded on the kured ds.
+func (dsl *DaemonSetLock) Waiters(ctx context.Context) ([]Waiter, error) {
+	ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseQueue(ds.Annotations, dsl.queueAnnotation())
+}
+
+// updateLock applies change to the lock recorded on the kured ds, retrying on conflicts.
+func (dsl *DaemonSetLock) updateLock(ctx context.Context, change func(value *multiLockAnnotationValue) error) error {
+	for attempt := 0; ; attempt++ {
+		ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+		if err != nil {
+			return err
+		}
+		value, _, err := dsl.readLockAnnotation(ds)
+		if err != nil {
+			return err
+		}
+		if err := change(&value); err != nil {
+			return err
+		}
+		if err := dsl.writeLockAnnotation(ds, value); err != nil {
+			return err
+		}
+
+		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(ctx, ds, metav1.UpdateOptions{})
+		if err != nil {
+			if errors.IsConflict(err) {
+				// Something else updated the resource between us reading and writing - try again soon
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// ReleaseNode removes the lock entry of the node from the kured ds annotation.
+func (dsl *DaemonSetLock) ReleaseNode(ctx context.Context, nodeID string) error {
+	return dsl.updateLock(ctx, func(value *multiLockAnnotationValue) error {
+		if forceRelease(value, func(holder string) bool { return holder == nodeID }) == 0 {
+			return fmt.Errorf("%w: %s", ErrNotHolder, nodeID)
+		}
+		return nil
+	})
+}
+
+// Clear removes all the lock entries from the kured ds annotation.
+func (dsl *DaemonSetLock) Clear(ctx context.Context) error {
+	return dsl.updateLock(ctx, func(value *multiLockAnnotationValue) error {
+		if forceRelease(value, func(string) bool { return true }) == 0 {
+			return fmt.Errorf("%w: lock is free", ErrNotHolder)
+		}
+		return nil
+	})
+}
+
+// Holders returns all the nodes recorded in the lock Leases.
+func (ll *LeaseLock) Holders(ctx context.Context) ([]LockAnnotationValue, error) {
+	leases, err := ll.GetLeases(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	var holders []LockAnnotationValue
+	for _, slot := range slices.Sorted(maps.Keys(leases)) {
+		value, _, err := leaseLockValue(leases[slot], ll.annotation)
+		if err != nil {
+			return nil, err
+		}
+		if value.NodeID != "" {
+			holders = append(holders, value)
+		}
+	}
+	return holders, nil
+}
+
+// Waiters returns the nodes waiting in the queue recorded on the queue Lease.
+func (ll *LeaseLock) Waiters(ctx context.Context) ([]Waiter, error) {
+	lease, err := ll.GetQueueLease(ctx)
+	if err != nil || lease == nil {
+		return nil, err
+	}
+	return parseQueue(lease.Annotations, ll.queueAnnotation())
+}
+
+// releaseLeases clears the holder of the lock Leases matching the given holder, retrying on conflicts,
+// and records them in the history.
+func (ll *LeaseLock) releaseLeases(ctx context.Context, matches func(holder string) bool) (int, error) {
+	var released []HistoryEntry
+	defer func() {
+		if len(released) > 0 {
+			if err := ll.recordHistory(ctx, 0, released...); err != nil {
+				log.Warnf("Error recording lock history: %v", err)
+			}
+		}
+	}()
+	for attempt := 0; ; attempt++ {
+		leases, err := ll.GetLeases(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+		if err != nil {
+			return len(released), err
+		}
+
+		var conflict error
+		for _, lease := range leases {
+			if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || !matches(*lease.Spec.HolderIdentity) {
+				continue
+			}
+			value, _, err := leaseLockValue(lease, ll.annotation)
+			if err != nil {
+				return len(released), err
+			}
+			if err := setLeaseHolder(lease, ll.annotation, nil); err != nil {
+				return len(released), err
+			}
+			_, err = ll.client.CoordinationV1().Leases(ll.leaseNamespace).Update(ctx, lease, metav1.UpdateOptions{})
+			if err != nil {
+				if errors.IsConflict(err) {
+					conflict = err
+					continue
+				}
+				return len(released), err
+			}
+			released = append(released, releaseEntry(value, OutcomeForceReleased))
+		}
+		if conflict == nil {
+			return len(released), nil
+		}
+		// Something else updated a lease between us reading and writing - try again soon
+		if err := waitConflictRetry(ctx, attempt, conflict); err != nil {
+			return len(released), err
+		}
+	}
+}
+
+// ReleaseNode clears the lock Lease held by the node.
+func (ll *LeaseLock) ReleaseNode(ctx context.Context, nodeID string) error {
+	released, err := ll.releaseLeases(ctx, func(holder string) bool {
+		return holder == nodeID
+	})
+	if err == nil && released == 0 {
+		return fmt.Errorf("%w: %s", ErrNotHolder, nodeID)
+	}
+	return err
+}
+
+// Clear clears all the lock Leases.
+func (ll *LeaseLock) Clear(ctx context.Context) error {
+	released, err := ll.releaseLeases(ctx, func(string) bool {
+		return true
+	})
+	if err == nil && released == 0 {
+		return fmt.Errorf("%w: lock is free", ErrNotHolder)
+	}
+	return err
+}
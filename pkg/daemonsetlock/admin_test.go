@@ -0,0 +1,38 @@
+package daemonsetlock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForceRelease(t *testing.T) {
+	created := time.Date(2020, 5, 5, 14, 15, 0, 0, time.UTC)
+	value := multiLockAnnotationValue{
+		MaxOwners: 2,
+		LockAnnotations: []LockAnnotationValue{
+			{NodeID: "n1", Created: created},
+			{NodeID: "n2", Created: created},
+		},
+	}
+
+	if released := forceRelease(&value, func(nodeID string) bool { return nodeID == "n3" }); released != 0 {
+		t.Errorf("no entry should be released for a node not holding the lock, got %d", released)
+	}
+
+	if released := forceRelease(&value, func(nodeID string) bool { return nodeID == "n1" }); released != 1 {
+		t.Fatalf("expected the entry of n1 to be released, got %d", released)
+	}
+	if len(value.LockAnnotations) != 1 || value.LockAnnotations[0].NodeID != "n2" {
+		t.Errorf("only n2 should remain in the lock, got %v", value.LockAnnotations)
+	}
+	if len(value.History) != 1 || value.History[0].NodeID != "n1" || value.History[0].Outcome != OutcomeForceReleased || !value.History[0].Acquired.Equal(created) {
+		t.Errorf("the release of n1 should be recorded in the history, got %v", value.History)
+	}
+
+	if released := forceRelease(&value, func(string) bool { return true }); released != 1 {
+		t.Fatalf("expected the entry of n2 to be released, got %d", released)
+	}
+	if len(value.LockAnnotations) != 0 || len(value.History) != 2 {
+		t.Errorf("lock should be empty with two history entries, got %v", value)
+	}
+}
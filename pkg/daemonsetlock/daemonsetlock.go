@@ -2,6 +2,7 @@
 // using Kubernetes DaemonSets. It enables distributed coordination of operations
 // (such as reboots) by ensuring only one node acts as the leader at any time,
 // leveraging Kubernetes primitives for safe, atomic locking in clusters.
+// The same locking semantics are available on top of coordination.k8s.io Leases.
 package daemonsetlock
 
 import (
@@ -16,6 +17,8 @@ import (
 	v1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 )
@@ -27,27 +30,65 @@ const (
 
 // Lock defines the interface for acquiring, releasing, and checking
 // the status of a reboot coordination lock.
+// The operations stop retrying when their context ends, returning an ErrTimeout;
+// ErrConflict and ErrNotHolder describe the other expected failures.
 type Lock interface {
-	Acquire(NodeMeta) (bool, string, error)
-	Release() error
-	Holding() (bool, LockAnnotationValue, error)
+	Acquire(context.Context, NodeMeta) (bool, string, error)
+	Release(ctx context.Context, outcome string) error
+	Holding(context.Context) (bool, LockAnnotationValue, error)
+	Renew(context.Context) error
+	Dequeue(context.Context) error
+	QueuePosition() int
+	History(context.Context) ([]HistoryEntry, error)
 }
 
-// GenericLock holds the configuration for lock TTL and the delay before releasing it.
+// GenericLock holds the configuration for lock TTL and the delay before releasing it,
+// along with the last known position of the node in the lock queue.
 type GenericLock struct {
-	TTL          time.Duration
-	releaseDelay time.Duration
+	TTL                  time.Duration
+	releaseDelay         time.Duration
+	maxOwnersPerTopology int
+	queueStaleAfter      time.Duration
+	queuePosition        int
+	historySize          int
+}
+
+// Option allows to change the configuration shared by all the lock types.
+type Option func(*GenericLock)
+
+// WithTopologyLimit limits the amount of nodes of the same topology domain
+// (see NodeMeta.Topology) which can hold the lock at the same time.
+// A limit lower than one disables the topology limit.
+func WithTopologyLimit(maxOwnersPerTopology int) Option {
+	return func(gl *GenericLock) {
+		gl.maxOwnersPerTopology = maxOwnersPerTopology
+	}
+}
+
+func newGenericLock(TTL, lockReleaseDelay time.Duration, opts ...Option) GenericLock {
+	gl := GenericLock{
+		TTL:          TTL,
+		releaseDelay: lockReleaseDelay,
+	}
+	for _, opt := range opts {
+		opt(&gl)
+	}
+	return gl
 }
 
 // NodeMeta contains metadata about a node relevant to scheduling decisions.
+// Topology is the value of the node's topology label (e.g. its zone),
+// used to limit the amount of concurrent reboots per topology domain.
 type NodeMeta struct {
-	Unschedulable bool `json:"unschedulable"`
+	Unschedulable bool      `json:"unschedulable"`
+	Topology      string    `json:"topology,omitempty"`
+	UID           types.UID `json:"uid,omitempty"`
 }
 
 // DaemonSetLock holds all necessary information to do actions
 // on the kured ds which holds lock info through annotations.
 type DaemonSetLock struct {
-	client     *kubernetes.Clientset
+	client     kubernetes.Interface
 	nodeID     string
 	namespace  string
 	name       string
@@ -56,9 +97,10 @@ type DaemonSetLock struct {
 
 // DaemonSetSingleLock holds all necessary information to do actions
 // on the kured ds which holds lock info through annotations.
+// It is a DaemonSetMultiLock limited to a single owner, so that both
+// read and write the same annotation and concurrency can change live.
 type DaemonSetSingleLock struct {
-	GenericLock
-	DaemonSetLock
+	DaemonSetMultiLock
 }
 
 // DaemonSetMultiLock holds all necessary information to do actions
@@ -67,33 +109,159 @@ type DaemonSetSingleLock struct {
 type DaemonSetMultiLock struct {
 	GenericLock
 	DaemonSetLock
-	maxOwners int
+	concurrency intstr.IntOrString
 }
 
 // LockAnnotationValue contains the lock data,
 // which allows persistence across reboots, particularily recording if the
 // node was already unschedulable before kured reboot.
 // To be modified when using another type of lock storage.
+// Renewed is refreshed by the holder while it works on the node, so that
+// the TTL only expires locks of nodes which stopped renewing them.
 type LockAnnotationValue struct {
 	NodeID   string        `json:"nodeID"`
 	Metadata NodeMeta      `json:"metadata,omitempty"`
 	Created  time.Time     `json:"created"`
+	Renewed  time.Time     `json:"renewed,omitzero"`
 	TTL      time.Duration `json:"TTL"`
 }
 
+// lastRenewal returns the last time the holder proved it was alive.
+func (value LockAnnotationValue) lastRenewal() time.Time {
+	if value.Renewed.After(value.Created) {
+		return value.Renewed
+	}
+	return value.Created
+}
+
+// expired reports whether the TTL elapsed since the last renewal of the lock.
+func (value LockAnnotationValue) expired() bool {
+	return ttlExpired(value.lastRenewal(), value.TTL)
+}
+
+// lockAnnotationVersion is the version of the lock annotation schema written by kured.
+// Annotations without a version were written by older releases, either as a bare
+// LockAnnotationValue (single lock) or as an unversioned multiLockAnnotationValue,
+// and are upgraded when read.
+const lockAnnotationVersion = 1
+
+// multiLockAnnotationValue is the lock annotation schema shared by all the lock owners.
+// History holds the last lock releases, which are stored in their own annotation so that
+// the lock annotation is removed when nobody holds the lock, as older releases expect.
 type multiLockAnnotationValue struct {
+	Version         int                   `json:"version"`
 	MaxOwners       int                   `json:"maxOwners"`
 	LockAnnotations []LockAnnotationValue `json:"locks"`
+	History         []HistoryEntry        `json:"-"`
+}
+
+// anyLockAnnotationValue can be decoded from all the lock annotation schemas.
+type anyLockAnnotationValue struct {
+	LockAnnotationValue
+	multiLockAnnotationValue
+}
+
+// parseLockAnnotation decodes a lock annotation, upgrading older schemas to the current one.
+func parseLockAnnotation(valueString string) (multiLockAnnotationValue, error) {
+	value := anyLockAnnotationValue{}
+	if err := json.Unmarshal([]byte(valueString), &value); err != nil {
+		return multiLockAnnotationValue{}, err
+	}
+	if value.Version > lockAnnotationVersion {
+		return multiLockAnnotationValue{}, fmt.Errorf("unsupported lock annotation version %d, kured supports up to version %d", value.Version, lockAnnotationVersion)
+	}
+	if value.NodeID != "" {
+		// Single lock written before the annotation was versioned
+		return multiLockAnnotationValue{
+			Version:         lockAnnotationVersion,
+			MaxOwners:       1,
+			LockAnnotations: []LockAnnotationValue{value.LockAnnotationValue},
+		}, nil
+	}
+	value.multiLockAnnotationValue.Version = lockAnnotationVersion
+	return value.multiLockAnnotationValue, nil
+}
+
+// readLockAnnotation returns the lock recorded on the kured ds along with the lock history,
+// and whether the lock annotation exists. The history is only informational: when it cannot
+// be read, a new one is started rather than failing the lock operations.
+func (dsl *DaemonSetLock) readLockAnnotation(ds *v1.DaemonSet) (multiLockAnnotationValue, bool, error) {
+	history, err := parseHistory(ds.Annotations, dsl.historyAnnotation())
+	if err != nil {
+		log.Warnf("Ignoring invalid lock history, starting a new one: %v", err)
+		history = nil
+	}
+	valueString, exists := ds.Annotations[dsl.annotation]
+	if !exists {
+		return multiLockAnnotationValue{Version: lockAnnotationVersion, History: history}, false, nil
+	}
+	value, err := parseLockAnnotation(valueString)
+	if err != nil {
+		return value, true, fmt.Errorf("error getting lock: %w", err)
+	}
+	value.History = history
+	return value, true, nil
+}
+
+// writeLockAnnotation records the lock and the lock history on the kured ds, removing
+// the lock annotation when nobody holds the lock, and the history annotation when it is empty.
+func (dsl *DaemonSetLock) writeLockAnnotation(ds *v1.DaemonSet, value multiLockAnnotationValue) error {
+	if ds.Annotations == nil {
+		ds.Annotations = make(map[string]string)
+	}
+	if len(value.History) == 0 {
+		delete(ds.Annotations, dsl.historyAnnotation())
+	} else {
+		historyBytes, err := json.Marshal(value.History)
+		if err != nil {
+			return fmt.Errorf("error marshalling lock history: %w", err)
+		}
+		ds.Annotations[dsl.historyAnnotation()] = string(historyBytes)
+	}
+	if len(value.LockAnnotations) == 0 {
+		delete(ds.Annotations, dsl.annotation)
+		return nil
+	}
+	value.Version = lockAnnotationVersion
+	valueBytes, err := json.Marshal(&value)
+	if err != nil {
+		return fmt.Errorf("error marshalling lock annotation: %w", err)
+	}
+	ds.Annotations[dsl.annotation] = string(valueBytes)
+	return nil
+}
+
+// ParseConcurrency validates a concurrency given either as an amount of nodes (e.g. "2"),
+// or as a percentage (e.g. "10%") of the nodes the kured ds is scheduled on.
+func ParseConcurrency(value string) (intstr.IntOrString, error) {
+	concurrency := intstr.Parse(value)
+	if concurrency.Type == intstr.String {
+		if !strings.HasSuffix(concurrency.StrVal, "%") {
+			return concurrency, fmt.Errorf("invalid concurrency %s, expected an integer or a percentage", value)
+		}
+		if _, err := intstr.GetScaledValueFromIntOrPercent(&concurrency, 100, false); err != nil {
+			return concurrency, fmt.Errorf("invalid concurrency %s: %w", value, err)
+		}
+	}
+	return concurrency, nil
+}
+
+// resolveMaxOwners returns the amount of nodes allowed to hold the lock at the same time.
+// A percentage is relative to the given amount of nodes, rounded down, and is at least one.
+func resolveMaxOwners(concurrency intstr.IntOrString, nodes int) int {
+	maxOwners, err := intstr.GetScaledValueFromIntOrPercent(&concurrency, nodes, false)
+	if err != nil || maxOwners < 1 {
+		return 1
+	}
+	return maxOwners
 }
 
 // New creates a daemonsetLock object containing the necessary data for follow up k8s requests
-func New(client *kubernetes.Clientset, nodeID, namespace, name, annotation string, TTL time.Duration, concurrency int, lockReleaseDelay time.Duration) Lock {
-	if concurrency > 1 {
+// A concurrency higher than one, or given as a percentage, requires a DaemonSetMultiLock.
+func New(client kubernetes.Interface, nodeID, namespace, name, annotation string, TTL time.Duration, concurrency intstr.IntOrString, lockReleaseDelay time.Duration, opts ...Option) Lock {
+	if concurrency.Type == intstr.String || concurrency.IntValue() > 1 {
 		return &DaemonSetMultiLock{
-			GenericLock: GenericLock{
-				TTL:          TTL,
-				releaseDelay: lockReleaseDelay,
-			},
+			GenericLock: newGenericLock(TTL, lockReleaseDelay, opts...),
 			DaemonSetLock: DaemonSetLock{
 				client:     client,
 				nodeID:     nodeID,
@@ -101,155 +269,40 @@ func New(client *kubernetes.Clientset, nodeID, namespace, name, annotation strin
 				name:       name,
 				annotation: annotation,
 			},
-			maxOwners: concurrency,
+			concurrency: concurrency,
 		}
 	}
 	return &DaemonSetSingleLock{
-		GenericLock: GenericLock{
-			TTL:          TTL,
-			releaseDelay: lockReleaseDelay,
-		},
-		DaemonSetLock: DaemonSetLock{
-			client:     client,
-			nodeID:     nodeID,
-			namespace:  namespace,
-			name:       name,
-			annotation: annotation,
+		DaemonSetMultiLock: DaemonSetMultiLock{
+			GenericLock: newGenericLock(TTL, lockReleaseDelay, opts...),
+			DaemonSetLock: DaemonSetLock{
+				client:     client,
+				nodeID:     nodeID,
+				namespace:  namespace,
+				name:       name,
+				annotation: annotation,
+			},
+			concurrency: intstr.FromInt32(1),
 		},
 	}
 }
 
 // GetDaemonSet returns the named DaemonSet resource from the DaemonSetLock's configured client
-func (dsl *DaemonSetLock) GetDaemonSet(sleep, timeout time.Duration) (*v1.DaemonSet, error) {
+func (dsl *DaemonSetLock) GetDaemonSet(ctx context.Context, sleep, timeout time.Duration) (*v1.DaemonSet, error) {
 	var ds *v1.DaemonSet
 	var lastError error
-	err := wait.PollUntilContextTimeout(context.Background(), sleep, timeout, true, func(ctx context.Context) (bool, error) {
+	err := wait.PollUntilContextTimeout(ctx, sleep, timeout, true, func(ctx context.Context) (bool, error) {
 		if ds, lastError = dsl.client.AppsV1().DaemonSets(dsl.namespace).Get(ctx, dsl.name, metav1.GetOptions{}); lastError != nil {
 			return false, nil
 		}
 		return true, nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("timed out trying to get daemonset %s in namespace %s: %v", dsl.name, dsl.namespace, lastError)
+		return nil, fmt.Errorf("%w trying to get daemonset %s in namespace %s: %v", ErrTimeout, dsl.name, dsl.namespace, lastError)
 	}
 	return ds, nil
 }
 
-// Acquire attempts to annotate the kured daemonset with lock info from instantiated DaemonSetLock using client-go
-func (dsl *DaemonSetSingleLock) Acquire(nodeMetadata NodeMeta) (bool, string, error) {
-	for {
-		ds, err := dsl.GetDaemonSet(k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
-		if err != nil {
-			return false, "", fmt.Errorf("timed out trying to get daemonset %s in namespace %s: %w", dsl.name, dsl.namespace, err)
-		}
-
-		valueString, exists := ds.Annotations[dsl.annotation]
-		if exists {
-			value := LockAnnotationValue{}
-			if err := json.Unmarshal([]byte(valueString), &value); err != nil {
-				return false, "", err
-			}
-
-			if !ttlExpired(value.Created, value.TTL) {
-				return value.NodeID == dsl.nodeID, value.NodeID, nil
-			}
-		}
-
-		if ds.Annotations == nil {
-			ds.Annotations = make(map[string]string)
-		}
-
-		value := LockAnnotationValue{
-			NodeID:   dsl.nodeID,
-			Metadata: nodeMetadata,
-			Created:  time.Now().UTC(),
-			TTL:      dsl.TTL,
-		}
-
-		valueBytes, err := json.Marshal(&value)
-		if err != nil {
-			return false, "", err
-		}
-		ds.Annotations[dsl.annotation] = string(valueBytes)
-
-		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(context.TODO(), ds, metav1.UpdateOptions{})
-		if err != nil {
-			if se, ok := err.(*errors.StatusError); ok && se.ErrStatus.Reason == metav1.StatusReasonConflict {
-				// Something else updated the resource between us reading and writing - try again soon
-				time.Sleep(time.Second)
-				continue
-			}
-			return false, "", err
-		}
-
-		return true, dsl.nodeID, nil
-	}
-}
-
-// Holding checks if the current node still holds the lock based on the DaemonSet annotation.
-func (dsl *DaemonSetSingleLock) Holding() (bool, LockAnnotationValue, error) {
-	var lockData LockAnnotationValue
-	ds, err := dsl.GetDaemonSet(k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
-	if err != nil {
-		return false, lockData, fmt.Errorf("timed out trying to get daemonset %s in namespace %s: %w", dsl.name, dsl.namespace, err)
-	}
-
-	valueString, exists := ds.Annotations[dsl.annotation]
-	if exists {
-		value := LockAnnotationValue{}
-		if err := json.Unmarshal([]byte(valueString), &value); err != nil {
-			return false, lockData, err
-		}
-
-		if !ttlExpired(value.Created, value.TTL) {
-			return value.NodeID == dsl.nodeID, value, nil
-		}
-	}
-
-	return false, lockData, nil
-}
-
-// Release attempts to remove the lock data from the kured ds annotations using client-go
-func (dsl *DaemonSetSingleLock) Release() error {
-	if dsl.releaseDelay > 0 {
-		log.Infof("Waiting %v before releasing lock", dsl.releaseDelay)
-		time.Sleep(dsl.releaseDelay)
-	}
-	for {
-		ds, err := dsl.GetDaemonSet(k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
-		if err != nil {
-			return fmt.Errorf("timed out trying to get daemonset %s in namespace %s: %w", dsl.name, dsl.namespace, err)
-		}
-
-		valueString, exists := ds.Annotations[dsl.annotation]
-		if exists {
-			value := LockAnnotationValue{}
-			if err := json.Unmarshal([]byte(valueString), &value); err != nil {
-				return err
-			}
-
-			if value.NodeID != dsl.nodeID {
-				return fmt.Errorf("not lock holder: %v", value.NodeID)
-			}
-		} else {
-			return fmt.Errorf("lock not held")
-		}
-
-		delete(ds.Annotations, dsl.annotation)
-
-		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(context.TODO(), ds, metav1.UpdateOptions{})
-		if err != nil {
-			if se, ok := err.(*errors.StatusError); ok && se.ErrStatus.Reason == metav1.StatusReasonConflict {
-				// Something else updated the resource between us reading and writing - try again soon
-				time.Sleep(time.Second)
-				continue
-			}
-			return err
-		}
-		return nil
-	}
-}
-
 func ttlExpired(created time.Time, ttl time.Duration) bool {
 	if ttl > 0 && time.Since(created) >= ttl {
 		return true
@@ -265,103 +318,147 @@ func nodeIDsFromMultiLock(annotation multiLockAnnotationValue) []string {
 	return nodeIDs
 }
 
-func (dsl *DaemonSetLock) canAcquireMultiple(annotation multiLockAnnotationValue, metadata NodeMeta, TTL time.Duration, maxOwners int) (bool, multiLockAnnotationValue) {
-	newAnnotation := multiLockAnnotationValue{MaxOwners: maxOwners}
-	freeSpace := false
-	if annotation.LockAnnotations == nil || len(annotation.LockAnnotations) < maxOwners {
-		freeSpace = true
-		newAnnotation.LockAnnotations = annotation.LockAnnotations
-	} else {
-		for _, nodeLock := range annotation.LockAnnotations {
-			if ttlExpired(nodeLock.Created, nodeLock.TTL) {
-				freeSpace = true
-				continue
-			}
-			newAnnotation.LockAnnotations = append(
-				newAnnotation.LockAnnotations,
-				nodeLock,
-			)
+// renewMultiple refreshes the renewal time of the node's entry in the multi lock,
+// returning false when the node does not hold a valid entry.
+func renewMultiple(annotation *multiLockAnnotationValue, nodeID string, now time.Time) bool {
+	for idx, nodeLock := range annotation.LockAnnotations {
+		if nodeLock.NodeID == nodeID && !nodeLock.expired() {
+			annotation.LockAnnotations[idx].Renewed = now
+			return true
 		}
 	}
+	return false
+}
 
-	if freeSpace {
+// canAcquireMultiple returns whether the node can be added to the multi lock, along with
+// the new lock value. Expired locks are removed, and the node is only added when the
+// lock has room for it overall and in its topology domain (if limited).
+// When the lock cannot be acquired, the returned value contains the current holders.
+func (dsl *DaemonSetLock) canAcquireMultiple(annotation multiLockAnnotationValue, metadata NodeMeta, TTL time.Duration, maxOwners, maxOwnersPerTopology int) (bool, multiLockAnnotationValue) {
+	newAnnotation := multiLockAnnotationValue{Version: lockAnnotationVersion, MaxOwners: maxOwners, History: annotation.History}
+	sameTopology := 0
+	for _, nodeLock := range annotation.LockAnnotations {
+		if nodeLock.expired() {
+			continue
+		}
+		if nodeLock.Metadata.Topology == metadata.Topology {
+			sameTopology++
+		}
 		newAnnotation.LockAnnotations = append(
 			newAnnotation.LockAnnotations,
-			LockAnnotationValue{
-				NodeID:   dsl.nodeID,
-				Metadata: metadata,
-				Created:  time.Now().UTC(),
-				TTL:      TTL,
-			},
+			nodeLock,
 		)
-		return true, newAnnotation
 	}
 
-	return false, multiLockAnnotationValue{}
+	if len(newAnnotation.LockAnnotations) >= maxOwners {
+		return false, newAnnotation
+	}
+	if maxOwnersPerTopology > 0 && metadata.Topology != "" && sameTopology >= maxOwnersPerTopology {
+		log.Infof("Topology %s already has %d node(s) holding the lock", metadata.Topology, sameTopology)
+		return false, newAnnotation
+	}
+
+	newAnnotation.LockAnnotations = append(
+		newAnnotation.LockAnnotations,
+		LockAnnotationValue{
+			NodeID:   dsl.nodeID,
+			Metadata: metadata,
+			Created:  time.Now().UTC(),
+			TTL:      TTL,
+		},
+	)
+	return true, newAnnotation
 }
 
 // Acquire creates and annotates the daemonset with a multiple owner lock
-func (dsl *DaemonSetMultiLock) Acquire(nodeMetaData NodeMeta) (bool, string, error) {
-	for {
-		ds, err := dsl.GetDaemonSet(k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+func (dsl *DaemonSetMultiLock) Acquire(ctx context.Context, nodeMetaData NodeMeta) (bool, string, error) {
+	for attempt := 0; ; attempt++ {
+		ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
 		if err != nil {
-			return false, "", fmt.Errorf("timed out trying to get daemonset %s in namespace %s: %w", dsl.name, dsl.namespace, err)
+			return false, "", err
 		}
 
-		annotation := multiLockAnnotationValue{}
-		valueString, exists := ds.Annotations[dsl.annotation]
-		if exists {
-			if err := json.Unmarshal([]byte(valueString), &annotation); err != nil {
-				return false, "", fmt.Errorf("error getting multi lock: %w", err)
+		annotation, _, err := dsl.readLockAnnotation(ds)
+		if err != nil {
+			return false, "", err
+		}
+		for _, nodeLock := range annotation.LockAnnotations {
+			if nodeLock.NodeID == dsl.nodeID && !nodeLock.expired() {
+				return true, dsl.nodeID, nil
 			}
 		}
 
-		lockPossible, newAnnotation := dsl.canAcquireMultiple(annotation, nodeMetaData, dsl.TTL, dsl.maxOwners)
-		if !lockPossible {
-			return false, strings.Join(nodeIDsFromMultiLock(newAnnotation), ","), nil
+		annotation.LockAnnotations = dsl.withoutGoneHolders(ctx, annotation.LockAnnotations)
+		maxOwners := resolveMaxOwners(dsl.concurrency, int(ds.Status.DesiredNumberScheduled))
+		lockPossible, newAnnotation := dsl.canAcquireMultiple(annotation, nodeMetaData, dsl.TTL, maxOwners, dsl.maxOwnersPerTopology)
+		holders := strings.Join(nodeIDsFromMultiLock(newAnnotation), ",")
+
+		var queue waitQueue
+		if dsl.queueEnabled() {
+			if queue, err = dsl.joinQueue(ctx, ds, nodeMetaData.Topology, dsl.queueStaleAfter); err != nil {
+				return false, "", err
+			}
+			if lockPossible {
+				// Our own entry was added to the lock by canAcquireMultiple
+				freeSlots := maxOwners - len(newAnnotation.LockAnnotations) + 1
+				blocked := topologyBlocked(dsl.nodeID, newAnnotation.LockAnnotations, dsl.maxOwnersPerTopology)
+				if !queue.mayAcquire(dsl.nodeID, freeSlots, blocked) {
+					log.Infof("Lock has %d free slot(s), but %s waited longer", freeSlots, queue.ahead(dsl.nodeID, blocked))
+					lockPossible = false
+					holders = queue.ahead(dsl.nodeID, blocked)
+				}
+			}
+		} else if !lockPossible {
+			return false, holders, nil
 		}
 
 		if ds.Annotations == nil {
 			ds.Annotations = make(map[string]string)
 		}
-		newAnnotationBytes, err := json.Marshal(&newAnnotation)
-		if err != nil {
-			return false, "", fmt.Errorf("error marshalling new annotation lock: %w", err)
+		if lockPossible {
+			if err := dsl.writeLockAnnotation(ds, newAnnotation); err != nil {
+				return false, "", err
+			}
+			queue = queue.leave(dsl.nodeID)
+		}
+		if dsl.queueEnabled() {
+			if err := setQueue(ds.Annotations, dsl.queueAnnotation(), queue); err != nil {
+				return false, "", err
+			}
 		}
-		ds.Annotations[dsl.annotation] = string(newAnnotationBytes)
 
-		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(context.Background(), ds, metav1.UpdateOptions{})
+		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(ctx, ds, metav1.UpdateOptions{})
 		if err != nil {
-			if se, ok := err.(*errors.StatusError); ok && se.ErrStatus.Reason == metav1.StatusReasonConflict {
-				time.Sleep(time.Second)
+			if errors.IsConflict(err) {
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return false, "", err
+				}
 				continue
 			}
 			return false, "", fmt.Errorf("error updating daemonset with multi lock: %w", err)
 
 		}
-		return true, strings.Join(nodeIDsFromMultiLock(newAnnotation), ","), nil
+		dsl.queuePosition = queue.position(dsl.nodeID)
+
+		return lockPossible, holders, nil
 	}
 }
 
 // Holding checks whether the current node is holding a valid lock for the DaemonSetMultiLock.
-func (dsl *DaemonSetMultiLock) Holding() (bool, LockAnnotationValue, error) {
+func (dsl *DaemonSetMultiLock) Holding(ctx context.Context) (bool, LockAnnotationValue, error) {
 	var lockdata LockAnnotationValue
-	ds, err := dsl.GetDaemonSet(k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+	ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
 	if err != nil {
-		return false, lockdata, fmt.Errorf("timed out trying to get daemonset %s in namespace %s: %w", dsl.name, dsl.namespace, err)
+		return false, lockdata, err
 	}
 
-	valueString, exists := ds.Annotations[dsl.annotation]
-	if exists {
-		value := multiLockAnnotationValue{}
-		if err := json.Unmarshal([]byte(valueString), &value); err != nil {
-			return false, lockdata, err
-		}
-
-		for _, nodeLock := range value.LockAnnotations {
-			if nodeLock.NodeID == dsl.nodeID && !ttlExpired(nodeLock.Created, nodeLock.TTL) {
-				return true, nodeLock, nil
-			}
+	value, _, err := dsl.readLockAnnotation(ds)
+	if err != nil {
+		return false, lockdata, err
+	}
+	for _, nodeLock := range value.LockAnnotations {
+		if nodeLock.NodeID == dsl.nodeID && !nodeLock.expired() {
+			return true, nodeLock, nil
 		}
 	}
 
@@ -369,49 +466,81 @@ func (dsl *DaemonSetMultiLock) Holding() (bool, LockAnnotationValue, error) {
 }
 
 // Release attempts to remove the lock data for a single node from the multi node annotation
-func (dsl *DaemonSetMultiLock) Release() error {
+func (dsl *DaemonSetMultiLock) Release(ctx context.Context, outcome string) error {
 	if dsl.releaseDelay > 0 {
 		log.Infof("Waiting %v before releasing lock", dsl.releaseDelay)
-		time.Sleep(dsl.releaseDelay)
+		if err := sleepContext(ctx, dsl.releaseDelay); err != nil {
+			return err
+		}
 	}
-	for {
-		ds, err := dsl.GetDaemonSet(k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+	for attempt := 0; ; attempt++ {
+		ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
 		if err != nil {
-			return fmt.Errorf("timed out trying to get daemonset %s in namespace %s: %w", dsl.name, dsl.namespace, err)
+			return err
 		}
 
-		valueString, exists := ds.Annotations[dsl.annotation]
+		value, exists, err := dsl.readLockAnnotation(ds)
+		if err != nil {
+			return err
+		}
 		modified := false
-		value := multiLockAnnotationValue{}
-		if exists {
-			if err := json.Unmarshal([]byte(valueString), &value); err != nil {
-				return err
+		for idx, nodeLock := range value.LockAnnotations {
+			if nodeLock.NodeID == dsl.nodeID {
+				value.LockAnnotations = append(value.LockAnnotations[:idx], value.LockAnnotations[idx+1:]...)
+				value.History = appendHistory(value.History, releaseEntry(nodeLock, outcome), dsl.historySize)
+				modified = true
+				break
 			}
+		}
+
+		if !exists || !modified {
+			return fmt.Errorf("%w: %s", ErrNotHolder, dsl.nodeID)
+		}
+		if err := dsl.writeLockAnnotation(ds, value); err != nil {
+			return err
+		}
 
-			for idx, nodeLock := range value.LockAnnotations {
-				if nodeLock.NodeID == dsl.nodeID {
-					value.LockAnnotations = append(value.LockAnnotations[:idx], value.LockAnnotations[idx+1:]...)
-					modified = true
-					break
+		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(ctx, ds, metav1.UpdateOptions{})
+		if err != nil {
+			if errors.IsConflict(err) {
+				// Something else updated the resource between us reading and writing - try again soon
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return err
 				}
+				continue
 			}
+			return err
 		}
+		return nil
+	}
+}
 
-		if !exists || !modified {
-			return fmt.Errorf("Lock not held")
+// Renew refreshes the renewal time of the node's entry in the multi node annotation
+func (dsl *DaemonSetMultiLock) Renew(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+		if err != nil {
+			return err
 		}
 
-		newAnnotationBytes, err := json.Marshal(value)
+		value, exists, err := dsl.readLockAnnotation(ds)
 		if err != nil {
-			return fmt.Errorf("error marshalling new annotation on release: %v", err)
+			return err
+		}
+		if !exists || !renewMultiple(&value, dsl.nodeID, time.Now().UTC()) {
+			return fmt.Errorf("%w: %s", ErrNotHolder, dsl.nodeID)
+		}
+		if err := dsl.writeLockAnnotation(ds, value); err != nil {
+			return err
 		}
-		ds.Annotations[dsl.annotation] = string(newAnnotationBytes)
 
-		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(context.TODO(), ds, metav1.UpdateOptions{})
+		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(ctx, ds, metav1.UpdateOptions{})
 		if err != nil {
-			if se, ok := err.(*errors.StatusError); ok && se.ErrStatus.Reason == metav1.StatusReasonConflict {
+			if errors.IsConflict(err) {
 				// Something else updated the resource between us reading and writing - try again soon
-				time.Sleep(time.Second)
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return err
+				}
 				continue
 			}
 			return err
@@ -5,6 +5,8 @@ import (
 	"sort"
 	"testing"
 	"time"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func TestTtlExpired(t *testing.T) {
@@ -29,6 +31,117 @@ func TestTtlExpired(t *testing.T) {
 	}
 }
 
+func TestParseConcurrency(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    intstr.IntOrString
+		wantErr bool
+	}{
+		{value: "1", want: intstr.FromInt32(1)},
+		{value: "3", want: intstr.FromInt32(3)},
+		{value: "10%", want: intstr.FromString("10%")},
+		{value: "ten", wantErr: true},
+		{value: "a%", wantErr: true},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.value, func(t *testing.T) {
+			got, err := ParseConcurrency(tst.value)
+			if (err != nil) != tst.wantErr {
+				t.Fatalf("ParseConcurrency() error = %v, wantErr %v", err, tst.wantErr)
+			}
+			if !tst.wantErr && got != tst.want {
+				t.Errorf("ParseConcurrency() = %v, want %v", got, tst.want)
+			}
+		})
+	}
+}
+
+func TestResolveMaxOwners(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency intstr.IntOrString
+		nodes       int
+		want        int
+	}{
+		{name: "absolute", concurrency: intstr.FromInt32(3), nodes: 500, want: 3},
+		{name: "absolute_below_one", concurrency: intstr.FromInt32(0), nodes: 500, want: 1},
+		{name: "percentage_of_large_cluster", concurrency: intstr.FromString("10%"), nodes: 500, want: 50},
+		{name: "percentage_rounded_down", concurrency: intstr.FromString("10%"), nodes: 29, want: 2},
+		{name: "percentage_of_small_cluster", concurrency: intstr.FromString("10%"), nodes: 5, want: 1},
+		{name: "percentage_of_unknown_cluster", concurrency: intstr.FromString("10%"), nodes: 0, want: 1},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			if got := resolveMaxOwners(tst.concurrency, tst.nodes); got != tst.want {
+				t.Errorf("resolveMaxOwners() = %v, want %v", got, tst.want)
+			}
+		})
+	}
+}
+
+func TestLockAnnotationValueExpired(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  LockAnnotationValue
+		result bool
+	}{
+		{
+			name:   "old_lock_without_renewal",
+			value:  LockAnnotationValue{Created: time.Now().Add(-1 * time.Hour), TTL: time.Minute},
+			result: true,
+		},
+		{
+			name:   "old_lock_recently_renewed",
+			value:  LockAnnotationValue{Created: time.Now().Add(-1 * time.Hour), Renewed: time.Now().Add(-30 * time.Second), TTL: time.Minute},
+			result: false,
+		},
+		{
+			name:   "old_lock_renewed_too_long_ago",
+			value:  LockAnnotationValue{Created: time.Now().Add(-1 * time.Hour), Renewed: time.Now().Add(-2 * time.Minute), TTL: time.Minute},
+			result: true,
+		},
+		{
+			name:   "old_lock_without_ttl",
+			value:  LockAnnotationValue{Created: time.Now().Add(-1 * time.Hour)},
+			result: false,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			if tst.value.expired() != tst.result {
+				t.Errorf("expected expired to be %v for %+v", tst.result, tst.value)
+			}
+		})
+	}
+}
+
+func TestRenewMultiple(t *testing.T) {
+	now := time.Now().UTC()
+	annotation := multiLockAnnotationValue{
+		MaxOwners: 2,
+		LockAnnotations: []LockAnnotationValue{
+			{NodeID: "n1", Created: now.Add(-1 * time.Hour), TTL: time.Minute},
+			{NodeID: "n2", Created: now.Add(-30 * time.Second), TTL: time.Minute},
+		},
+	}
+
+	if renewMultiple(&annotation, "n1", now) {
+		t.Errorf("expired lock of n1 should not be renewed")
+	}
+	if renewMultiple(&annotation, "n3", now) {
+		t.Errorf("n3 does not hold the lock and should not renew it")
+	}
+	if !renewMultiple(&annotation, "n2", now) {
+		t.Fatalf("lock of n2 should be renewed")
+	}
+	if !annotation.LockAnnotations[1].Renewed.Equal(now) {
+		t.Errorf("expected renewal time %v, got %v", now, annotation.LockAnnotations[1].Renewed)
+	}
+}
+
 func multiLockAnnotationsAreEqualByNodes(src, dst multiLockAnnotationValue) bool {
 	srcNodes := []string{}
 	for _, srcLock := range src.LockAnnotations {
@@ -50,12 +163,14 @@ func TestCanAcquireMultiple(t *testing.T) {
 	node2Name := "n2"
 	node3Name := "n3"
 	testCases := []struct {
-		name          string
-		daemonSetLock DaemonSetLock
-		maxOwners     int
-		current       multiLockAnnotationValue
-		desired       multiLockAnnotationValue
-		lockPossible  bool
+		name                 string
+		daemonSetLock        DaemonSetLock
+		maxOwners            int
+		maxOwnersPerTopology int
+		nodeMeta             NodeMeta
+		current              multiLockAnnotationValue
+		desired              multiLockAnnotationValue
+		lockPossible         bool
 	}{
 		{
 			name: "empty_lock",
@@ -182,11 +297,100 @@ func TestCanAcquireMultiple(t *testing.T) {
 			},
 			lockPossible: true,
 		},
+		{
+			name: "partial_lock_with_full_topology",
+			daemonSetLock: DaemonSetLock{
+				nodeID: node1Name,
+			},
+			maxOwners:            3,
+			maxOwnersPerTopology: 1,
+			nodeMeta:             NodeMeta{Topology: "zone-a"},
+			current: multiLockAnnotationValue{
+				MaxOwners: 3,
+				LockAnnotations: []LockAnnotationValue{
+					{NodeID: node2Name, Metadata: NodeMeta{Topology: "zone-a"}},
+				},
+			},
+			lockPossible: false,
+		},
+		{
+			name: "partial_lock_with_free_topology",
+			daemonSetLock: DaemonSetLock{
+				nodeID: node1Name,
+			},
+			maxOwners:            3,
+			maxOwnersPerTopology: 1,
+			nodeMeta:             NodeMeta{Topology: "zone-b"},
+			current: multiLockAnnotationValue{
+				MaxOwners: 3,
+				LockAnnotations: []LockAnnotationValue{
+					{NodeID: node2Name, Metadata: NodeMeta{Topology: "zone-a"}},
+				},
+			},
+			desired: multiLockAnnotationValue{
+				MaxOwners: 3,
+				LockAnnotations: []LockAnnotationValue{
+					{NodeID: node1Name},
+					{NodeID: node2Name},
+				},
+			},
+			lockPossible: true,
+		},
+		{
+			name: "partial_lock_with_topology_freed_by_expiry",
+			daemonSetLock: DaemonSetLock{
+				nodeID: node1Name,
+			},
+			maxOwners:            3,
+			maxOwnersPerTopology: 1,
+			nodeMeta:             NodeMeta{Topology: "zone-a"},
+			current: multiLockAnnotationValue{
+				MaxOwners: 3,
+				LockAnnotations: []LockAnnotationValue{
+					{
+						NodeID:   node2Name,
+						Metadata: NodeMeta{Topology: "zone-a"},
+						Created:  time.Now().UTC().Add(-1 * time.Hour),
+						TTL:      time.Minute,
+					},
+					{NodeID: node3Name, Metadata: NodeMeta{Topology: "zone-b"}},
+				},
+			},
+			desired: multiLockAnnotationValue{
+				MaxOwners: 3,
+				LockAnnotations: []LockAnnotationValue{
+					{NodeID: node1Name},
+					{NodeID: node3Name},
+				},
+			},
+			lockPossible: true,
+		},
+		{
+			name: "partial_lock_with_unlimited_topology",
+			daemonSetLock: DaemonSetLock{
+				nodeID: node1Name,
+			},
+			maxOwners: 3,
+			nodeMeta:  NodeMeta{Topology: "zone-a"},
+			current: multiLockAnnotationValue{
+				MaxOwners: 3,
+				LockAnnotations: []LockAnnotationValue{
+					{NodeID: node2Name, Metadata: NodeMeta{Topology: "zone-a"}},
+				},
+			},
+			desired: multiLockAnnotationValue{
+				MaxOwners: 3,
+				LockAnnotations: []LockAnnotationValue{
+					{NodeID: node1Name},
+					{NodeID: node2Name},
+				},
+			},
+			lockPossible: true,
+		},
 	}
-	nm := NodeMeta{Unschedulable: false}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			lockPossible, actual := testCase.daemonSetLock.canAcquireMultiple(testCase.current, nm, time.Minute, testCase.maxOwners)
+			lockPossible, actual := testCase.daemonSetLock.canAcquireMultiple(testCase.current, testCase.nodeMeta, time.Minute, testCase.maxOwners, testCase.maxOwnersPerTopology)
 			if lockPossible != testCase.lockPossible {
 				t.Fatalf(
 					"unexpected result for lock possible (got %t expected %t new annotation %v",
@@ -206,3 +410,68 @@ func TestCanAcquireMultiple(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLockAnnotation(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         string
+		wantNodes     []string
+		wantMaxOwners int
+		wantErr       bool
+	}{
+		{
+			name:          "unversioned_single_lock",
+			value:         `{"nodeID":"n1","metadata":{"unschedulable":false},"created":"2020-05-05T14:15:00Z","TTL":0}`,
+			wantNodes:     []string{"n1"},
+			wantMaxOwners: 1,
+		},
+		{
+			name:          "unversioned_multi_lock",
+			value:         `{"maxOwners":2,"locks":[{"nodeID":"n1","created":"2020-05-05T14:15:00Z","TTL":0},{"nodeID":"n2","created":"2020-05-05T14:15:00Z","TTL":0}]}`,
+			wantNodes:     []string{"n1", "n2"},
+			wantMaxOwners: 2,
+		},
+		{
+			name:          "versioned_lock",
+			value:         `{"version":1,"maxOwners":3,"locks":[{"nodeID":"n1","created":"2020-05-05T14:15:00Z","TTL":0}]}`,
+			wantNodes:     []string{"n1"},
+			wantMaxOwners: 3,
+		},
+		{
+			name:          "empty_lock",
+			value:         `{"version":1,"maxOwners":2,"locks":[]}`,
+			wantMaxOwners: 2,
+		},
+		{
+			name:    "future_version",
+			value:   `{"version":2,"maxOwners":2,"locks":[]}`,
+			wantErr: true,
+		},
+		{
+			name:    "broken_lock",
+			value:   `{`,
+			wantErr: true,
+		},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			value, err := parseLockAnnotation(tst.value)
+			if (err != nil) != tst.wantErr {
+				t.Fatalf("parseLockAnnotation() error = %v, wantErr %v", err, tst.wantErr)
+			}
+			if tst.wantErr {
+				return
+			}
+			if value.Version != lockAnnotationVersion {
+				t.Errorf("parseLockAnnotation() version = %d, want %d", value.Version, lockAnnotationVersion)
+			}
+			if value.MaxOwners != tst.wantMaxOwners {
+				t.Errorf("parseLockAnnotation() maxOwners = %d, want %d", value.MaxOwners, tst.wantMaxOwners)
+			}
+			if !reflect.DeepEqual(nodeIDsFromMultiLock(value), append([]string{}, tst.wantNodes...)) {
+				t.Errorf("parseLockAnnotation() holders = %v, want %v", nodeIDsFromMultiLock(value), tst.wantNodes)
+			}
+		})
+	}
+}
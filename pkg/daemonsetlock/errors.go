@@ -0,0 +1,47 @@
+package daemonsetlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	conflictRetries    = 10          // How many times to retry an update conflicting with other writers of the lock
+	conflictRetryDelay = time.Second // How much time to wait before retrying an update which conflicted
+)
+
+var (
+	// ErrConflict is returned when other nodes kept modifying the lock while this node tried to update it.
+	ErrConflict = errors.New("lock modified concurrently")
+	// ErrTimeout is returned when the lock could not be read or written before the context or the
+	// API call timeout ended.
+	ErrTimeout = errors.New("lock operation timed out")
+	// ErrNotHolder is returned when the node is expected to hold the lock but does not.
+	ErrNotHolder = errors.New("lock not held by node")
+)
+
+// waitConflictRetry waits before retrying an update which conflicted with another writer of the lock.
+// It returns an ErrConflict once the update conflicted too many times, and an ErrTimeout when ctx ends.
+func waitConflictRetry(ctx context.Context, attempt int, err error) error {
+	if attempt >= conflictRetries {
+		return fmt.Errorf("%w after %d attempts: %w", ErrConflict, attempt+1, err)
+	}
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	case <-time.After(conflictRetryDelay):
+		return nil
+	}
+}
+
+// sleepContext waits for the given duration, returning an ErrTimeout if ctx ends first.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	case <-time.After(duration):
+		return nil
+	}
+}
@@ -0,0 +1,38 @@
+package daemonsetlock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitConflictRetry(t *testing.T) {
+	conflict := errors.New("conflict")
+
+	if err := waitConflictRetry(context.Background(), conflictRetries, conflict); !errors.Is(err, ErrConflict) || !errors.Is(err, conflict) {
+		t.Errorf("expected an ErrConflict wrapping the last conflict after %d attempts, got %v", conflictRetries, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := waitConflictRetry(ctx, 0, conflict); !errors.Is(err, ErrTimeout) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected an ErrTimeout once the context ended, got %v", err)
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	if err := sleepContext(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("sleepContext() unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sleepContext(ctx, time.Hour); !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected an ErrTimeout once the context deadline passed, got %v", err)
+	}
+	if time.Since(start) > time.Minute {
+		t.Errorf("sleepContext() did not stop at the context deadline")
+	}
+}
@@ -0,0 +1,36 @@
+package daemonsetlock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Heartbeat renews the lock held by the node every interval, in the background,
+// until the returned stop function is called or ctx ends. Failed renewals are only
+// logged, and renewing stops once the node no longer holds the lock.
+func Heartbeat(ctx context.Context, lock Lock, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := lock.Renew(ctx)
+				if errors.Is(err, ErrNotHolder) {
+					log.Warnf("Stopped renewing lock: %v", err)
+					return
+				}
+				if err != nil && ctx.Err() == nil {
+					log.Warnf("Error renewing lock: %v", err)
+				}
+			}
+		}
+	}()
+	return cancel
+}
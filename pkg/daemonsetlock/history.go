@@ -0,0 +1,128 @@
+package daemonsetlock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultHistorySize is the amount of lock releases kept in the lock history by default.
+const DefaultHistorySize = 20
+
+// Outcomes recorded in the lock history, describing why the lock was released.
+const (
+	OutcomeRebooted      = "rebooted"
+	OutcomeDrainFailed   = "drain-failed"
+	OutcomeForceReleased = "force-released"
+	// OutcomeInterrupted is used when the reboot was not triggered, e.g. when kured restarted before
+	OutcomeInterrupted = "interrupted"
+	// OutcomeNotRebooted is used when the reboot was triggered, but the node did not reboot
+	OutcomeNotRebooted = "not-rebooted"
+)
+
+// HistoryEntry records a node which held the lock, and how its lock ended.
+type HistoryEntry struct {
+	NodeID   string    `json:"nodeID"`
+	Acquired time.Time `json:"acquired"`
+	Released time.Time `json:"released"`
+	Outcome  string    `json:"outcome"`
+}
+
+// Held returns how long the node held the lock.
+func (entry HistoryEntry) Held() time.Duration {
+	return entry.Released.Sub(entry.Acquired)
+}
+
+// WithHistory keeps the last size lock releases in the lock history.
+func WithHistory(size int) Option {
+	return func(gl *GenericLock) {
+		gl.historySize = size
+	}
+}
+
+// appendHistory records the entry at the end of the history, dropping the oldest entries beyond size.
+// The history is left untouched when size is not positive.
+func appendHistory(history []HistoryEntry, entry HistoryEntry, size int) []HistoryEntry {
+	if size <= 0 {
+		return history
+	}
+	history = append(history, entry)
+	if len(history) > size {
+		history = history[len(history)-size:]
+	}
+	return history
+}
+
+// releaseEntry returns the history entry of a lock released now.
+func releaseEntry(value LockAnnotationValue, outcome string) HistoryEntry {
+	return HistoryEntry{
+		NodeID:   value.NodeID,
+		Acquired: value.Created,
+		Released: time.Now().UTC(),
+		Outcome:  outcome,
+	}
+}
+
+// History returns the last lock releases recorded on the kured ds, oldest first.
+func (dsl *DaemonSetLock) History(ctx context.Context) ([]HistoryEntry, error) {
+	ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseHistory(ds.Annotations, dsl.historyAnnotation())
+}
+
+func (ll *LeaseLock) historyLeaseName() string {
+	return ll.leaseName + "-history"
+}
+
+func (dsl *DaemonSetLock) historyAnnotation() string {
+	return dsl.annotation + "-history"
+}
+
+func parseHistory(annotations map[string]string, annotation string) ([]HistoryEntry, error) {
+	var history []HistoryEntry
+	if valueString, exists := annotations[annotation]; exists {
+		if err := json.Unmarshal([]byte(valueString), &history); err != nil {
+			return nil, fmt.Errorf("error getting lock history: %w", err)
+		}
+	}
+	return history, nil
+}
+
+// recordHistory appends the entries to the history recorded on the history Lease, keeping
+// its last size entries. A size of 0 is used when operators release locks, see forcedHistorySize.
+func (ll *LeaseLock) recordHistory(ctx context.Context, size int, entries ...HistoryEntry) error {
+	return ll.updateLeaseAnnotations(ctx, ll.historyLeaseName(), func(annotations map[string]string) error {
+		history, err := parseHistory(annotations, ll.historyAnnotation())
+		if err != nil {
+			log.Warnf("Ignoring invalid lock history, starting a new one: %v", err)
+			history = nil
+		}
+		limit := size
+		if limit == 0 {
+			limit = forcedHistorySize(history)
+		}
+		for _, entry := range entries {
+			history = appendHistory(history, entry, limit)
+		}
+		historyBytes, err := json.Marshal(history)
+		if err != nil {
+			return fmt.Errorf("error marshalling lock history: %w", err)
+		}
+		annotations[ll.historyAnnotation()] = string(historyBytes)
+		return nil
+	})
+}
+
+// History returns the last lock releases recorded on the history Lease, oldest first.
+func (ll *LeaseLock) History(ctx context.Context) ([]HistoryEntry, error) {
+	lease, err := ll.getLease(ctx, ll.historyLeaseName())
+	if err != nil || lease == nil {
+		return nil, err
+	}
+	return parseHistory(lease.Annotations, ll.historyAnnotation())
+}
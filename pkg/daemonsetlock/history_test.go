@@ -0,0 +1,103 @@
+package daemonsetlock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/apps/v1"
+)
+
+func TestAppendHistory(t *testing.T) {
+	entry := func(nodeID string) HistoryEntry {
+		return HistoryEntry{NodeID: nodeID, Outcome: OutcomeRebooted}
+	}
+	nodeIDs := func(history []HistoryEntry) []string {
+		var ids []string
+		for _, e := range history {
+			ids = append(ids, e.NodeID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name    string
+		history []HistoryEntry
+		size    int
+		want    []string
+	}{
+		{name: "disabled", history: []HistoryEntry{entry("n1")}, size: 0, want: []string{"n1"}},
+		{name: "empty_history", size: 2, want: []string{"n2"}},
+		{name: "room_left", history: []HistoryEntry{entry("n1")}, size: 2, want: []string{"n1", "n2"}},
+		{name: "full_history", history: []HistoryEntry{entry("n0"), entry("n1")}, size: 2, want: []string{"n1", "n2"}},
+		{name: "shrunk_history", history: []HistoryEntry{entry("n0"), entry("n1"), entry("n3")}, size: 1, want: []string{"n2"}},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			got := nodeIDs(appendHistory(tst.history, entry("n2"), tst.size))
+			if !reflect.DeepEqual(got, tst.want) {
+				t.Errorf("appendHistory() = %v, want %v", got, tst.want)
+			}
+		})
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+	annotation := "weave.works/kured-node-lock-history"
+	annotations := map[string]string{
+		annotation: `[{"nodeID":"n1","acquired":"2020-05-05T14:15:00Z","released":"2020-05-05T14:45:00Z","outcome":"rebooted"}]`,
+	}
+
+	history, err := parseHistory(annotations, annotation)
+	if err != nil || len(history) != 1 {
+		t.Fatalf("parseHistory() = %v, %v", history, err)
+	}
+	if history[0].Held() != 30*time.Minute {
+		t.Errorf("expected the lock to be held 30m, got %v", history[0].Held())
+	}
+
+	if _, err := parseHistory(map[string]string{annotation: `{`}, annotation); err == nil {
+		t.Errorf("parseHistory() should fail on a broken annotation")
+	}
+}
+
+func TestWriteLockAnnotationHistory(t *testing.T) {
+	dsl := &DaemonSetLock{annotation: "weave.works/kured-node-lock"}
+	ds := &v1.DaemonSet{}
+	created := time.Now().UTC().Add(-time.Hour)
+	value := multiLockAnnotationValue{MaxOwners: 1, LockAnnotations: []LockAnnotationValue{{NodeID: "n1", Created: created}}}
+
+	if err := dsl.writeLockAnnotation(ds, value); err != nil {
+		t.Fatalf("writeLockAnnotation() unexpected error: %v", err)
+	}
+	value, _, err := dsl.readLockAnnotation(ds)
+	if err != nil {
+		t.Fatalf("readLockAnnotation() unexpected error: %v", err)
+	}
+	value.History = appendHistory(value.History, releaseEntry(value.LockAnnotations[0], OutcomeRebooted), DefaultHistorySize)
+	value.LockAnnotations = nil
+	if err := dsl.writeLockAnnotation(ds, value); err != nil {
+		t.Fatalf("writeLockAnnotation() unexpected error: %v", err)
+	}
+
+	// Older releases consider the lock held as long as the lock annotation exists
+	if _, exists := ds.Annotations[dsl.annotation]; exists {
+		t.Errorf("lock annotation should be removed when nobody holds the lock, got %v", ds.Annotations)
+	}
+	value, exists, err := dsl.readLockAnnotation(ds)
+	if err != nil || exists {
+		t.Fatalf("readLockAnnotation() = %v, %v, want no lock", exists, err)
+	}
+	if len(value.History) != 1 || value.History[0].NodeID != "n1" || !value.History[0].Acquired.Equal(created) {
+		t.Errorf("the release of n1 should be kept in the history annotation, got %v", value.History)
+	}
+
+	// A broken history does not prevent locking
+	ds.Annotations[dsl.historyAnnotation()] = `{`
+	ds.Annotations[dsl.annotation] = `{"version":1,"maxOwners":1,"locks":[{"nodeID":"n2","created":"2020-05-05T14:15:00Z","TTL":0}]}`
+	value, exists, err = dsl.readLockAnnotation(ds)
+	if err != nil || !exists || len(value.LockAnnotations) != 1 || len(value.History) != 0 {
+		t.Errorf("readLockAnnotation() = %v, %v, %v, want the lock of n2 with a new history", value, exists, err)
+	}
+}
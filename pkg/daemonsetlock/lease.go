@@ -0,0 +1,525 @@
+package daemonsetlock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Compile-time checks to ensure the type implements the interface
+var (
+	_ Lock = (*LeaseLock)(nil)
+)
+
+// LeaseLabel is set on all the Leases of a lock, with the lock lease name as value,
+// so that the lock Leases can be listed without reading the other Leases of the namespace.
+const LeaseLabel = "kured.kubereboot.io/lock"
+
+// LeaseLock holds all necessary information to do actions on the
+// coordination.k8s.io Leases which hold lock info. Each Lease is a slot
+// which can be held by a single node, so that the amount of Leases
+// is the amount of nodes allowed to hold the lock at the same time.
+// The kured ds is only read, to resolve a concurrency given as a percentage.
+type LeaseLock struct {
+	GenericLock
+	DaemonSetLock
+	leaseNamespace string
+	leaseName      string
+	concurrency    intstr.IntOrString
+}
+
+// NewLeaseLock creates a LeaseLock object containing the necessary data for follow up k8s requests.
+// The lock is spread over Leases named <leaseName>-<slot> in leaseNamespace, which should only
+// contain the kured Leases, so that kured is not allowed to update the Leases of other components.
+func NewLeaseLock(client kubernetes.Interface, nodeID, namespace, name, leaseNamespace, leaseName, annotation string, TTL time.Duration, concurrency intstr.IntOrString, lockReleaseDelay time.Duration, opts ...Option) Lock {
+	return &LeaseLock{
+		GenericLock: newGenericLock(TTL, lockReleaseDelay, opts...),
+		DaemonSetLock: DaemonSetLock{
+			client:     client,
+			nodeID:     nodeID,
+			namespace:  namespace,
+			name:       name,
+			annotation: annotation,
+		},
+		leaseNamespace: leaseNamespace,
+		leaseName:      leaseName,
+		concurrency:    concurrency,
+	}
+}
+
+func leaseSlotName(name string, slot int) string {
+	return fmt.Sprintf("%s-%d", name, slot)
+}
+
+// leaseSlot returns the slot of a lease named <name>-<slot>, or -1 for any other lease.
+func leaseSlot(name, leaseName string) int {
+	suffix, found := strings.CutPrefix(leaseName, name+"-")
+	if !found {
+		return -1
+	}
+	slot, err := strconv.Atoi(suffix)
+	if err != nil || slot < 0 || strconv.Itoa(slot) != suffix {
+		return -1
+	}
+	return slot
+}
+
+// newLease returns a new Lease of the lock, labelled with LeaseLabel.
+func (ll *LeaseLock) newLease(name string) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ll.leaseNamespace,
+			Labels:    map[string]string{LeaseLabel: ll.leaseName},
+		},
+	}
+}
+
+// GetLeases returns the existing Leases of the lock, indexed by slot.
+func (ll *LeaseLock) GetLeases(ctx context.Context, sleep, timeout time.Duration) (map[int]*coordinationv1.Lease, error) {
+	var leaseList *coordinationv1.LeaseList
+	var lastError error
+	listOptions := metav1.ListOptions{LabelSelector: LeaseLabel + "=" + ll.leaseName}
+	err := wait.PollUntilContextTimeout(ctx, sleep, timeout, true, func(ctx context.Context) (bool, error) {
+		if leaseList, lastError = ll.client.CoordinationV1().Leases(ll.leaseNamespace).List(ctx, listOptions); lastError != nil {
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w trying to list leases in namespace %s: %v", ErrTimeout, ll.leaseNamespace, lastError)
+	}
+
+	leases := make(map[int]*coordinationv1.Lease)
+	for i := range leaseList.Items {
+		if slot := leaseSlot(ll.leaseName, leaseList.Items[i].Name); slot >= 0 {
+			leases[slot] = &leaseList.Items[i]
+		}
+	}
+	return leases, nil
+}
+
+// maxOwners returns the amount of lease slots currently usable.
+func (ll *LeaseLock) maxOwners(ctx context.Context) (int, error) {
+	if ll.concurrency.Type == intstr.Int {
+		return resolveMaxOwners(ll.concurrency, 0), nil
+	}
+	ds, err := ll.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+	if err != nil {
+		return 0, err
+	}
+	return resolveMaxOwners(ll.concurrency, int(ds.Status.DesiredNumberScheduled)), nil
+}
+
+// ownLease returns the lease held by the node along with its lock data, or nil if it holds none.
+func (ll *LeaseLock) ownLease(leases map[int]*coordinationv1.Lease) (*coordinationv1.Lease, LockAnnotationValue, error) {
+	for _, lease := range leases {
+		value, held, err := leaseLockValue(lease, ll.annotation)
+		if err != nil {
+			return nil, value, err
+		}
+		if held && value.NodeID == ll.nodeID {
+			return lease, value, nil
+		}
+	}
+	return nil, LockAnnotationValue{}, nil
+}
+
+// leaseLockValue returns the lock data recorded on a lease, and whether
+// the lease is currently held by a node whose lock did not expire.
+func leaseLockValue(lease *coordinationv1.Lease, annotation string) (LockAnnotationValue, bool, error) {
+	value := LockAnnotationValue{}
+	if lease == nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		return value, false, nil
+	}
+
+	if valueString, exists := lease.Annotations[annotation]; exists {
+		if err := json.Unmarshal([]byte(valueString), &value); err != nil {
+			return value, false, err
+		}
+	} else {
+		// Lease written by someone else than kured, only trust its spec.
+		if lease.Spec.AcquireTime != nil {
+			value.Created = lease.Spec.AcquireTime.UTC()
+		}
+		if lease.Spec.RenewTime != nil {
+			value.Renewed = lease.Spec.RenewTime.UTC()
+		}
+		if lease.Spec.LeaseDurationSeconds != nil {
+			value.TTL = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+		}
+	}
+	value.NodeID = *lease.Spec.HolderIdentity
+
+	return value, !value.expired(), nil
+}
+
+// setLeaseHolder records value as the holder of the lease, or clears the holder when value is nil.
+func setLeaseHolder(lease *coordinationv1.Lease, annotation string, value *LockAnnotationValue) error {
+	if value == nil {
+		lease.Spec = coordinationv1.LeaseSpec{}
+		delete(lease.Annotations, annotation)
+		return nil
+	}
+
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if lease.Annotations == nil {
+		lease.Annotations = make(map[string]string)
+	}
+	lease.Annotations[annotation] = string(valueBytes)
+
+	holder := value.NodeID
+	acquired := metav1.NewMicroTime(value.Created)
+	renewed := metav1.NewMicroTime(value.lastRenewal())
+	lease.Spec = coordinationv1.LeaseSpec{
+		HolderIdentity: &holder,
+		AcquireTime:    &acquired,
+		RenewTime:      &renewed,
+	}
+	if value.TTL > 0 {
+		seconds := int32(value.TTL.Seconds())
+		lease.Spec.LeaseDurationSeconds = &seconds
+	}
+	return nil
+}
+
+// Acquire attempts to take a free lease slot for the node
+func (ll *LeaseLock) Acquire(ctx context.Context, nodeMetadata NodeMeta) (bool, string, error) {
+	for attempt := 0; ; attempt++ {
+		maxOwners, err := ll.maxOwners(ctx)
+		if err != nil {
+			return false, "", err
+		}
+		leases, err := ll.GetLeases(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+		if err != nil {
+			return false, "", err
+		}
+
+		var holders []string
+		var holderValues []LockAnnotationValue
+		sameTopology := 0
+		reclaimable := make(map[int]bool)
+		for slot, lease := range leases {
+			value, held, err := leaseLockValue(lease, ll.annotation)
+			if err != nil {
+				return false, "", fmt.Errorf("error getting lease lock: %w", err)
+			}
+			if !held {
+				continue
+			}
+			if value.NodeID == ll.nodeID {
+				return true, ll.nodeID, nil
+			}
+			if ll.holderGone(ctx, value) {
+				reclaimable[slot] = true
+				continue
+			}
+			holders = append(holders, value.NodeID)
+			holderValues = append(holderValues, value)
+			if value.Metadata.Topology == nodeMetadata.Topology {
+				sameTopology++
+			}
+		}
+
+		var queue waitQueue
+		if ll.queueEnabled() {
+			queue, err = ll.updateQueue(ctx, func(queue waitQueue) waitQueue {
+				now := time.Now().UTC()
+				return queue.prune(now, ll.queueStaleAfter, func(waiter Waiter) bool {
+					return ll.waiterGone(ctx, waiter)
+				}).join(ll.nodeID, nodeMetadata.Topology, now)
+			})
+			if err != nil {
+				return false, "", err
+			}
+			ll.queuePosition = queue.position(ll.nodeID)
+		}
+
+		if len(holders) >= maxOwners {
+			return false, strings.Join(holders, ","), nil
+		}
+		if ll.maxOwnersPerTopology > 0 && nodeMetadata.Topology != "" && sameTopology >= ll.maxOwnersPerTopology {
+			log.Infof("Topology %s already has %d node(s) holding the lock", nodeMetadata.Topology, sameTopology)
+			return false, strings.Join(holders, ","), nil
+		}
+		blocked := topologyBlocked(ll.nodeID, holderValues, ll.maxOwnersPerTopology)
+		if !queue.mayAcquire(ll.nodeID, maxOwners-len(holders), blocked) {
+			log.Infof("Lock has %d free slot(s), but %s waited longer", maxOwners-len(holders), queue.ahead(ll.nodeID, blocked))
+			return false, queue.ahead(ll.nodeID, blocked), nil
+		}
+
+		// Holders of slots above maxOwners (when concurrency shrank) still
+		// count against the limit above, so a free slot below it exists.
+		freeSlot := 0
+		for ; freeSlot < maxOwners; freeSlot++ {
+			if _, held, _ := leaseLockValue(leases[freeSlot], ll.annotation); !held || reclaimable[freeSlot] {
+				break
+			}
+		}
+
+		value := LockAnnotationValue{
+			NodeID:   ll.nodeID,
+			Metadata: nodeMetadata,
+			Created:  time.Now().UTC(),
+			TTL:      ll.TTL,
+		}
+
+		freeLease, exists := leases[freeSlot]
+		if !exists {
+			freeLease = ll.newLease(leaseSlotName(ll.leaseName, freeSlot))
+		}
+		if err := setLeaseHolder(freeLease, ll.annotation, &value); err != nil {
+			return false, "", err
+		}
+		if exists {
+			_, err = ll.client.CoordinationV1().Leases(ll.leaseNamespace).Update(ctx, freeLease, metav1.UpdateOptions{})
+		} else {
+			_, err = ll.client.CoordinationV1().Leases(ll.leaseNamespace).Create(ctx, freeLease, metav1.CreateOptions{})
+		}
+		if err != nil {
+			if errors.IsConflict(err) || errors.IsAlreadyExists(err) {
+				// Another node took the slot between us reading and writing - try again soon
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return false, "", err
+				}
+				continue
+			}
+			return false, "", fmt.Errorf("error writing lease %s: %w", freeLease.Name, err)
+		}
+		if err := ll.Dequeue(ctx); err != nil {
+			log.Warnf("Error leaving lock queue: %v", err)
+		}
+
+		return true, strings.Join(append(holders, ll.nodeID), ","), nil
+	}
+}
+
+// Holding checks whether the current node is holding a valid lease slot.
+func (ll *LeaseLock) Holding(ctx context.Context) (bool, LockAnnotationValue, error) {
+	leases, err := ll.GetLeases(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+	if err != nil {
+		return false, LockAnnotationValue{}, err
+	}
+
+	lease, value, err := ll.ownLease(leases)
+	if err != nil || lease == nil {
+		return false, LockAnnotationValue{}, err
+	}
+	return true, value, nil
+}
+
+// Release attempts to clear the holder of the lease slot held by the node
+func (ll *LeaseLock) Release(ctx context.Context, outcome string) error {
+	if ll.releaseDelay > 0 {
+		log.Infof("Waiting %v before releasing lock", ll.releaseDelay)
+		if err := sleepContext(ctx, ll.releaseDelay); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		leases, err := ll.GetLeases(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+		if err != nil {
+			return err
+		}
+
+		var ownLease *coordinationv1.Lease
+		for _, lease := range leases {
+			if lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == ll.nodeID {
+				ownLease = lease
+				break
+			}
+		}
+
+		if ownLease == nil {
+			return fmt.Errorf("%w: %s", ErrNotHolder, ll.nodeID)
+		}
+
+		value, _, err := leaseLockValue(ownLease, ll.annotation)
+		if err != nil {
+			return err
+		}
+		if err := setLeaseHolder(ownLease, ll.annotation, nil); err != nil {
+			return err
+		}
+
+		_, err = ll.client.CoordinationV1().Leases(ll.leaseNamespace).Update(ctx, ownLease, metav1.UpdateOptions{})
+		if err != nil {
+			if errors.IsConflict(err) {
+				// Something else updated the resource between us reading and writing - try again soon
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		if ll.historySize > 0 {
+			if err := ll.recordHistory(ctx, ll.historySize, releaseEntry(value, outcome)); err != nil {
+				log.Warnf("Error recording lock history: %v", err)
+			}
+		}
+		return nil
+	}
+}
+
+// Renew refreshes the renewal time of the lease slot held by the node
+func (ll *LeaseLock) Renew(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		leases, err := ll.GetLeases(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+		if err != nil {
+			return err
+		}
+
+		ownLease, value, err := ll.ownLease(leases)
+		if err != nil {
+			return err
+		}
+		if ownLease == nil {
+			return fmt.Errorf("%w: %s", ErrNotHolder, ll.nodeID)
+		}
+
+		value.Renewed = time.Now().UTC()
+		if err := setLeaseHolder(ownLease, ll.annotation, &value); err != nil {
+			return err
+		}
+
+		_, err = ll.client.CoordinationV1().Leases(ll.leaseNamespace).Update(ctx, ownLease, metav1.UpdateOptions{})
+		if err != nil {
+			if errors.IsConflict(err) {
+				// Something else updated the resource between us reading and writing - try again soon
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+func (ll *LeaseLock) queueLeaseName() string {
+	return ll.leaseName + "-queue"
+}
+
+// getLease returns the named Lease, or nil if it does not exist yet.
+func (ll *LeaseLock) getLease(ctx context.Context, name string) (*coordinationv1.Lease, error) {
+	var lease *coordinationv1.Lease
+	var lastError error
+	err := wait.PollUntilContextTimeout(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout, true, func(ctx context.Context) (bool, error) {
+		lease, lastError = ll.client.CoordinationV1().Leases(ll.leaseNamespace).Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(lastError) {
+			lease, lastError = nil, nil
+		}
+		return lastError == nil, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w trying to get lease %s in namespace %s: %v", ErrTimeout, name, ll.leaseNamespace, lastError)
+	}
+	return lease, nil
+}
+
+// GetQueueLease returns the Lease holding the lock queue, or nil if it does not exist yet.
+func (ll *LeaseLock) GetQueueLease(ctx context.Context) (*coordinationv1.Lease, error) {
+	return ll.getLease(ctx, ll.queueLeaseName())
+}
+
+// updateLeaseAnnotations applies change to the annotations of the named Lease,
+// creating it if needed, and retrying on conflicts.
+func (ll *LeaseLock) updateLeaseAnnotations(ctx context.Context, name string, change func(annotations map[string]string) error) error {
+	for attempt := 0; ; attempt++ {
+		lease, err := ll.getLease(ctx, name)
+		if err != nil {
+			return err
+		}
+		exists := lease != nil
+		if !exists {
+			lease = ll.newLease(name)
+		}
+		if lease.Annotations == nil {
+			lease.Annotations = make(map[string]string)
+		}
+		if err := change(lease.Annotations); err != nil {
+			return err
+		}
+
+		if exists {
+			_, err = ll.client.CoordinationV1().Leases(ll.leaseNamespace).Update(ctx, lease, metav1.UpdateOptions{})
+		} else {
+			_, err = ll.client.CoordinationV1().Leases(ll.leaseNamespace).Create(ctx, lease, metav1.CreateOptions{})
+		}
+		if err != nil {
+			if errors.IsConflict(err) || errors.IsAlreadyExists(err) {
+				// Something else updated the resource between us reading and writing - try again soon
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// updateQueue applies change to the queue recorded on the queue Lease, and returns the new queue.
+func (ll *LeaseLock) updateQueue(ctx context.Context, change func(waitQueue) waitQueue) (waitQueue, error) {
+	var queue waitQueue
+	err := ll.updateLeaseAnnotations(ctx, ll.queueLeaseName(), func(annotations map[string]string) error {
+		current, err := parseQueue(annotations, ll.queueAnnotation())
+		if err != nil {
+			return err
+		}
+		queue = change(current)
+		return setQueue(annotations, ll.queueAnnotation(), queue)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return queue, nil
+}
+
+// Dequeue removes the node from the lock queue, when it no longer waits for the lock.
+// The queue Lease is checked, as the node may have joined the queue before kured restarted.
+func (ll *LeaseLock) Dequeue(ctx context.Context) error {
+	if !ll.queueEnabled() {
+		return nil
+	}
+	lease, err := ll.GetQueueLease(ctx)
+	if err != nil {
+		return err
+	}
+	var queue waitQueue
+	if lease != nil {
+		if queue, err = parseQueue(lease.Annotations, ll.queueAnnotation()); err != nil {
+			return err
+		}
+	}
+	if queue.position(ll.nodeID) == 0 {
+		ll.queuePosition = 0
+		return nil
+	}
+	_, err = ll.updateQueue(ctx, func(queue waitQueue) waitQueue {
+		return queue.leave(ll.nodeID)
+	})
+	if err != nil {
+		return err
+	}
+	ll.queuePosition = 0
+	return nil
+}
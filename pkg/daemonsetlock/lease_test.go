@@ -0,0 +1,276 @@
+package daemonsetlock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestLeaseLockValue(t *testing.T) {
+	annotation := "weave.works/kured-node-lock"
+	node1Name := "n1"
+	empty := ""
+	expiredAcquire := metav1.NewMicroTime(time.Now().Add(-1 * time.Hour))
+	recentAcquire := metav1.NewMicroTime(time.Now().Add(-1 * time.Minute))
+	tenMinutes := int32(600)
+
+	testCases := []struct {
+		name       string
+		lease      *coordinationv1.Lease
+		wantHeld   bool
+		wantNodeID string
+		wantErr    bool
+	}{
+		{
+			name:     "missing_lease",
+			lease:    nil,
+			wantHeld: false,
+		},
+		{
+			name: "lease_without_holder",
+			lease: &coordinationv1.Lease{
+				Spec: coordinationv1.LeaseSpec{HolderIdentity: &empty},
+			},
+			wantHeld: false,
+		},
+		{
+			name: "lease_held_without_ttl",
+			lease: &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotation: `{"nodeID":"n1","created":"2020-05-05T14:15:00Z","TTL":0}`},
+				},
+				Spec: coordinationv1.LeaseSpec{HolderIdentity: &node1Name},
+			},
+			wantHeld:   true,
+			wantNodeID: node1Name,
+		},
+		{
+			name: "lease_held_with_expired_ttl",
+			lease: &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotation: `{"nodeID":"n1","created":"2020-05-05T14:15:00Z","TTL":1000000000}`},
+				},
+				Spec: coordinationv1.LeaseSpec{HolderIdentity: &node1Name},
+			},
+			wantHeld:   false,
+			wantNodeID: node1Name,
+		},
+		{
+			name: "foreign_lease_within_duration",
+			lease: &coordinationv1.Lease{
+				Spec: coordinationv1.LeaseSpec{HolderIdentity: &node1Name, AcquireTime: &recentAcquire, LeaseDurationSeconds: &tenMinutes},
+			},
+			wantHeld:   true,
+			wantNodeID: node1Name,
+		},
+		{
+			name: "foreign_lease_past_duration",
+			lease: &coordinationv1.Lease{
+				Spec: coordinationv1.LeaseSpec{HolderIdentity: &node1Name, AcquireTime: &expiredAcquire, LeaseDurationSeconds: &tenMinutes},
+			},
+			wantHeld:   false,
+			wantNodeID: node1Name,
+		},
+		{
+			name: "broken_annotation",
+			lease: &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{annotation: `{`},
+				},
+				Spec: coordinationv1.LeaseSpec{HolderIdentity: &node1Name},
+			},
+			wantErr: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			value, held, err := leaseLockValue(testCase.lease, annotation)
+			if (err != nil) != testCase.wantErr {
+				t.Fatalf("leaseLockValue() error = %v, wantErr %v", err, testCase.wantErr)
+			}
+			if held != testCase.wantHeld {
+				t.Errorf("leaseLockValue() held = %v, want %v", held, testCase.wantHeld)
+			}
+			if !testCase.wantErr && value.NodeID != testCase.wantNodeID {
+				t.Errorf("leaseLockValue() nodeID = %v, want %v", value.NodeID, testCase.wantNodeID)
+			}
+		})
+	}
+}
+
+func TestSetLeaseHolder(t *testing.T) {
+	annotation := "weave.works/kured-node-lock"
+	lease := &coordinationv1.Lease{}
+	value := LockAnnotationValue{
+		NodeID:  "n1",
+		Created: time.Now().UTC(),
+		TTL:     time.Hour,
+	}
+
+	if err := setLeaseHolder(lease, annotation, &value); err != nil {
+		t.Fatalf("setLeaseHolder() unexpected error: %v", err)
+	}
+	if *lease.Spec.HolderIdentity != "n1" || *lease.Spec.LeaseDurationSeconds != 3600 {
+		t.Errorf("unexpected lease spec after acquire: %+v", lease.Spec)
+	}
+	read, held, err := leaseLockValue(lease, annotation)
+	if err != nil || !held || read.NodeID != "n1" {
+		t.Errorf("lease not read back as held by n1: %+v %v %v", read, held, err)
+	}
+
+	if err := setLeaseHolder(lease, annotation, nil); err != nil {
+		t.Fatalf("setLeaseHolder() unexpected error: %v", err)
+	}
+	if _, held, _ := leaseLockValue(lease, annotation); held {
+		t.Errorf("lease still held after release: %+v", lease)
+	}
+}
+
+func TestLeaseSlot(t *testing.T) {
+	tests := []struct {
+		leaseName string
+		want      int
+	}{
+		{leaseName: "kured-0", want: 0},
+		{leaseName: "kured-12", want: 12},
+		{leaseName: "kured", want: -1},
+		{leaseName: "kured-", want: -1},
+		{leaseName: "kured-01", want: -1},
+		{leaseName: "kured-control-plane-0", want: -1},
+		{leaseName: "other-0", want: -1},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.leaseName, func(t *testing.T) {
+			if got := leaseSlot("kured", tst.leaseName); got != tst.want {
+				t.Errorf("leaseSlot() = %v, want %v", got, tst.want)
+			}
+		})
+	}
+}
+
+// newTestLeaseLock returns the lease lock of the node, with a concurrency of 2.
+func newTestLeaseLock(client kubernetes.Interface, nodeID string) *LeaseLock {
+	return NewLeaseLock(client, nodeID, "kube-system", "kured", "kured-lock", "kured", "weave.works/kured-node-lock", 0, intstr.FromInt32(2), 0).(*LeaseLock)
+}
+
+func leaseHolder(t *testing.T, client kubernetes.Interface, name string) string {
+	t.Helper()
+	lease, err := client.CoordinationV1().Leases("kured-lock").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("error getting lease %s: %v", name, err)
+	}
+	if lease.Labels[LeaseLabel] != "kured" {
+		t.Errorf("lease %s should be labelled %s=kured, got %v", name, LeaseLabel, lease.Labels)
+	}
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func TestLeaseLockAcquireRelease(t *testing.T) {
+	ctx := context.Background()
+	intruder, n2Name := "intruder", "n2"
+	leases := schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}
+	client := fake.NewClientset(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n1"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n2"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n3"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "intruder"}},
+		// Leases without the label are not part of the lock, even when named like a slot
+		&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: "kured-2", Namespace: "kured-lock"},
+			Spec:       coordinationv1.LeaseSpec{HolderIdentity: &intruder},
+		},
+	)
+	// n2 creates the first slot between n1 listing and creating the leases
+	raced := false
+	client.PrependReactor("create", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lease := action.(k8stesting.CreateAction).GetObject().(*coordinationv1.Lease)
+		if raced || lease.Name != "kured-0" {
+			return false, nil, nil
+		}
+		raced = true
+		taken := lease.DeepCopy()
+		taken.Spec = coordinationv1.LeaseSpec{HolderIdentity: &n2Name}
+		delete(taken.Annotations, "weave.works/kured-node-lock")
+		if err := client.Tracker().Add(taken); err != nil {
+			return true, nil, err
+		}
+		return true, nil, apierrors.NewAlreadyExists(leases, lease.Name)
+	})
+
+	n1, n2, n3 := newTestLeaseLock(client, "n1"), newTestLeaseLock(client, "n2"), newTestLeaseLock(client, "n3")
+	if acquired, _, err := n1.Acquire(ctx, NodeMeta{}); err != nil || !acquired {
+		t.Fatalf("n1 Acquire() = %v, %v, want acquired", acquired, err)
+	}
+	if holder := leaseHolder(t, client, "kured-1"); holder != "n1" {
+		t.Errorf("n1 should hold kured-1 after losing the race for kured-0, got %q", holder)
+	}
+	if acquired, _, err := n2.Acquire(ctx, NodeMeta{}); err != nil || !acquired {
+		t.Fatalf("n2 Acquire() = %v, %v, want n2 to already hold the lock", acquired, err)
+	}
+	if acquired, _, err := n3.Acquire(ctx, NodeMeta{}); err != nil || acquired {
+		t.Fatalf("n3 Acquire() = %v, %v, want all the slots to be held", acquired, err)
+	}
+
+	if err := n1.Release(ctx, OutcomeRebooted); err != nil {
+		t.Fatalf("n1 Release() unexpected error: %v", err)
+	}
+	if holder := leaseHolder(t, client, "kured-1"); holder != "" {
+		t.Errorf("kured-1 should be free after the release of n1, got %q", holder)
+	}
+	if err := n1.Release(ctx, OutcomeRebooted); !errors.Is(err, ErrNotHolder) {
+		t.Errorf("second n1 Release() error = %v, want ErrNotHolder", err)
+	}
+	if acquired, _, err := n3.Acquire(ctx, NodeMeta{}); err != nil || !acquired {
+		t.Fatalf("n3 Acquire() = %v, %v, want the slot released by n1", acquired, err)
+	}
+	if holder := leaseHolder(t, client, "kured-1"); holder != "n3" {
+		t.Errorf("n3 should hold kured-1, got %q", holder)
+	}
+}
+
+func TestLeaseLockRenew(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n1"}})
+	n1 := newTestLeaseLock(client, "n1")
+
+	if err := n1.Renew(ctx); !errors.Is(err, ErrNotHolder) {
+		t.Errorf("Renew() error = %v, want ErrNotHolder before acquiring", err)
+	}
+	if acquired, _, err := n1.Acquire(ctx, NodeMeta{}); err != nil || !acquired {
+		t.Fatalf("Acquire() = %v, %v, want acquired", acquired, err)
+	}
+	_, before, _ := n1.Holding(ctx)
+
+	// Another writer updated the lease meanwhile: the renewal is retried
+	conflicts := 0
+	client.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, "kured-0", errors.New("modified"))
+	})
+	if err := n1.Renew(ctx); err != nil {
+		t.Fatalf("Renew() unexpected error: %v", err)
+	}
+	holding, after, err := n1.Holding(ctx)
+	if err != nil || !holding || !after.Renewed.After(before.lastRenewal()) {
+		t.Errorf("Holding() = %v, %+v, %v, want the lease renewed after %v", holding, after, err, before.lastRenewal())
+	}
+}
@@ -0,0 +1,224 @@
+package daemonsetlock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Waiter is a node waiting for the lock to be free. LastSeen is refreshed
+// each time the node tries to acquire the lock, and waiters not seen for a
+// while, or whose node was deleted, are removed from the queue.
+type Waiter struct {
+	NodeID   string    `json:"nodeID"`
+	Topology string    `json:"topology,omitempty"`
+	Enqueued time.Time `json:"enqueued"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// waitQueue is the list of nodes waiting for the lock, ordered by arrival.
+type waitQueue []Waiter
+
+// WithQueue makes the nodes wait for the lock in a first in, first out queue:
+// free slots of the lock are only granted to the nodes at the head of the queue.
+// Waiters which did not try to acquire the lock for staleAfter are removed from the queue.
+func WithQueue(staleAfter time.Duration) Option {
+	return func(gl *GenericLock) {
+		gl.queueStaleAfter = staleAfter
+	}
+}
+
+func (gl *GenericLock) queueEnabled() bool {
+	return gl.queueStaleAfter > 0
+}
+
+// QueuePosition returns the position of the node in the lock queue, as of its last
+// attempt to acquire the lock, starting at 1. It returns 0 when the node is not waiting.
+func (gl *GenericLock) QueuePosition() int {
+	return gl.queuePosition
+}
+
+// prune removes the waiters not seen for staleAfter, and the head of the queue when gone
+// returns true for it. Only the head is checked, as it is the one holding the others back,
+// so that each attempt to acquire the lock costs at most one lookup.
+func (q waitQueue) prune(now time.Time, staleAfter time.Duration, gone func(Waiter) bool) waitQueue {
+	var pruned waitQueue
+	for _, waiter := range q {
+		if now.Sub(waiter.LastSeen) < staleAfter {
+			pruned = append(pruned, waiter)
+		}
+	}
+	if len(pruned) > 0 && gone(pruned[0]) {
+		pruned = pruned[1:]
+	}
+	return pruned
+}
+
+// join adds the node at the tail of the queue, or refreshes it if it is already waiting.
+func (q waitQueue) join(nodeID, topology string, now time.Time) waitQueue {
+	for idx := range q {
+		if q[idx].NodeID == nodeID {
+			q[idx].Topology = topology
+			q[idx].LastSeen = now
+			return q
+		}
+	}
+	return append(q, Waiter{NodeID: nodeID, Topology: topology, Enqueued: now, LastSeen: now})
+}
+
+// leave removes the node from the queue.
+func (q waitQueue) leave(nodeID string) waitQueue {
+	var left waitQueue
+	for _, waiter := range q {
+		if waiter.NodeID != nodeID {
+			left = append(left, waiter)
+		}
+	}
+	return left
+}
+
+// position returns the position of the node in the queue starting at 1, or 0 if absent.
+func (q waitQueue) position(nodeID string) int {
+	for idx, waiter := range q {
+		if waiter.NodeID == nodeID {
+			return idx + 1
+		}
+	}
+	return 0
+}
+
+// mayAcquire reports whether the node is allowed to take one of the free slots: the waiters
+// before it take them first, except the ones for which blocked returns true, which cannot
+// acquire the lock anyway. Nodes not in the queue (e.g. when the queue is disabled) are always allowed.
+func (q waitQueue) mayAcquire(nodeID string, freeSlots int, blocked func(Waiter) bool) bool {
+	if q.position(nodeID) == 0 {
+		return true
+	}
+	return len(q.aheadOf(nodeID, blocked)) < freeSlots
+}
+
+// ahead returns the nodes waiting before the node and not blocked, or the whole queue if it is absent.
+func (q waitQueue) ahead(nodeID string, blocked func(Waiter) bool) string {
+	return strings.Join(q.aheadOf(nodeID, blocked), ",")
+}
+
+func (q waitQueue) aheadOf(nodeID string, blocked func(Waiter) bool) []string {
+	var nodeIDs []string
+	for _, waiter := range q {
+		if waiter.NodeID == nodeID {
+			break
+		}
+		if !blocked(waiter) {
+			nodeIDs = append(nodeIDs, waiter.NodeID)
+		}
+	}
+	return nodeIDs
+}
+
+// topologyBlocked returns whether waiters cannot acquire the lock, as the nodes of their topology
+// domain already hold as many lock entries as allowed by maxOwnersPerTopology. Expired entries
+// and entries of the node itself are not counted.
+func topologyBlocked(nodeID string, holders []LockAnnotationValue, maxOwnersPerTopology int) func(Waiter) bool {
+	sameTopology := make(map[string]int)
+	for _, holder := range holders {
+		if holder.NodeID != nodeID && !holder.expired() {
+			sameTopology[holder.Metadata.Topology]++
+		}
+	}
+	return func(waiter Waiter) bool {
+		return maxOwnersPerTopology > 0 && waiter.Topology != "" && sameTopology[waiter.Topology] >= maxOwnersPerTopology
+	}
+}
+
+func (dsl *DaemonSetLock) queueAnnotation() string {
+	return dsl.annotation + "-queue"
+}
+
+func parseQueue(annotations map[string]string, annotation string) (waitQueue, error) {
+	var queue waitQueue
+	if valueString, exists := annotations[annotation]; exists {
+		if err := json.Unmarshal([]byte(valueString), &queue); err != nil {
+			return nil, fmt.Errorf("error getting lock queue: %w", err)
+		}
+	}
+	return queue, nil
+}
+
+// setQueue records the queue in the given annotations, removing the annotation when nobody waits.
+func setQueue(annotations map[string]string, annotation string, queue waitQueue) error {
+	if len(queue) == 0 {
+		delete(annotations, annotation)
+		return nil
+	}
+	queueBytes, err := json.Marshal(queue)
+	if err != nil {
+		return fmt.Errorf("error marshalling lock queue: %w", err)
+	}
+	annotations[annotation] = string(queueBytes)
+	return nil
+}
+
+// joinQueue returns the queue recorded on the kured ds, refreshed with the node's attempt.
+func (dsl *DaemonSetLock) joinQueue(ctx context.Context, ds *v1.DaemonSet, topology string, staleAfter time.Duration) (waitQueue, error) {
+	queue, err := parseQueue(ds.Annotations, dsl.queueAnnotation())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return queue.prune(now, staleAfter, func(waiter Waiter) bool {
+		return dsl.waiterGone(ctx, waiter)
+	}).join(dsl.nodeID, topology, now), nil
+}
+
+// leaveQueue removes the node from the queue recorded on the kured ds.
+func (dsl *DaemonSetLock) leaveQueue(ctx context.Context) error {
+	for attempt := 0; ; attempt++ {
+		ds, err := dsl.GetDaemonSet(ctx, k8sAPICallRetrySleep, k8sAPICallRetryTimeout)
+		if err != nil {
+			return err
+		}
+
+		queue, err := parseQueue(ds.Annotations, dsl.queueAnnotation())
+		if err != nil {
+			return err
+		}
+		if queue.position(dsl.nodeID) == 0 {
+			return nil
+		}
+		if err := setQueue(ds.Annotations, dsl.queueAnnotation(), queue.leave(dsl.nodeID)); err != nil {
+			return err
+		}
+
+		_, err = dsl.client.AppsV1().DaemonSets(dsl.namespace).Update(ctx, ds, metav1.UpdateOptions{})
+		if err != nil {
+			if errors.IsConflict(err) {
+				// Something else updated the resource between us reading and writing - try again soon
+				if err := waitConflictRetry(ctx, attempt, err); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// Dequeue removes the node from the lock queue, when it no longer waits for the lock.
+// The queue recorded on the kured ds is checked, as the node may have joined it before kured restarted.
+func (dsl *DaemonSetMultiLock) Dequeue(ctx context.Context) error {
+	if !dsl.queueEnabled() {
+		return nil
+	}
+	if err := dsl.leaveQueue(ctx); err != nil {
+		return err
+	}
+	dsl.queuePosition = 0
+	return nil
+}
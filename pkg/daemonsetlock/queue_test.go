@@ -0,0 +1,150 @@
+package daemonsetlock
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func notBlocked(Waiter) bool { return false }
+
+func TestWaitQueue(t *testing.T) {
+	now := time.Now().UTC()
+	queue := waitQueue{
+		{NodeID: "n1", Enqueued: now.Add(-3 * time.Hour), LastSeen: now.Add(-10 * time.Minute)},
+		{NodeID: "n2", Enqueued: now.Add(-2 * time.Hour), LastSeen: now.Add(-5 * time.Hour)},
+		{NodeID: "n3", Enqueued: now.Add(-1 * time.Hour), LastSeen: now.Add(-20 * time.Minute)},
+	}
+
+	queue = queue.prune(now, time.Hour, func(Waiter) bool { return false })
+	if queue.position("n2") != 0 {
+		t.Errorf("stale waiter n2 should have been pruned: %v", queue)
+	}
+	if queue.position("n1") != 1 || queue.position("n3") != 2 {
+		t.Errorf("pruning should keep the order of the waiters: %v", queue)
+	}
+	if gone := queue.prune(now, time.Hour, func(waiter Waiter) bool { return waiter.NodeID == "n1" }); gone.position("n1") != 0 || gone.position("n3") != 1 {
+		t.Errorf("waiter n1 whose node is gone should have been pruned: %v", gone)
+	}
+	if gone := queue.prune(now, time.Hour, func(waiter Waiter) bool { return waiter.NodeID == "n3" }); gone.position("n3") != 2 {
+		t.Errorf("only the head of the queue should be checked, got %v", gone)
+	}
+
+	queue = queue.join("n4", "", now)
+	if queue.position("n4") != 3 {
+		t.Errorf("new waiter n4 should be at the tail of the queue: %v", queue)
+	}
+
+	queue = queue.join("n3", "", now)
+	if queue.position("n3") != 2 || len(queue) != 3 || !queue[1].LastSeen.Equal(now) {
+		t.Errorf("known waiter n3 should be refreshed at the same position: %v", queue)
+	}
+	if queue.ahead("n4", notBlocked) != "n1,n3" {
+		t.Errorf("expected n1,n3 to wait before n4, got %s", queue.ahead("n4", notBlocked))
+	}
+
+	queue = queue.leave("n1")
+	if queue.position("n1") != 0 || queue.position("n3") != 1 {
+		t.Errorf("n1 should have left the queue: %v", queue)
+	}
+}
+
+func TestWaitQueueMayAcquire(t *testing.T) {
+	now := time.Now().UTC()
+	queue := waitQueue{}.join("n1", "", now).join("n2", "", now).join("n3", "", now)
+
+	tests := []struct {
+		name      string
+		nodeID    string
+		freeSlots int
+		want      bool
+	}{
+		{name: "head_with_free_slot", nodeID: "n1", freeSlots: 1, want: true},
+		{name: "second_with_one_free_slot", nodeID: "n2", freeSlots: 1, want: false},
+		{name: "second_with_two_free_slots", nodeID: "n2", freeSlots: 2, want: true},
+		{name: "head_without_free_slot", nodeID: "n1", freeSlots: 0, want: false},
+		{name: "not_queued", nodeID: "n4", freeSlots: 1, want: true},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			if got := queue.mayAcquire(tst.nodeID, tst.freeSlots, notBlocked); got != tst.want {
+				t.Errorf("mayAcquire() = %v, want %v", got, tst.want)
+			}
+		})
+	}
+}
+
+func TestWaitQueueTopology(t *testing.T) {
+	now := time.Now().UTC()
+	queue := waitQueue{}.join("a1", "zone-a", now).join("b1", "zone-b", now)
+	holders := []LockAnnotationValue{{NodeID: "a0", Metadata: NodeMeta{Topology: "zone-a"}}}
+
+	// a1 cannot acquire the lock while a0 holds it, so b1 takes the free slot
+	blocked := topologyBlocked("b1", holders, 1)
+	if !queue.mayAcquire("b1", 1, blocked) || queue.ahead("b1", blocked) != "" {
+		t.Errorf("b1 should skip a1, blocked by the topology limit")
+	}
+	// Without topology limit, a1 waited longer
+	if queue.mayAcquire("b1", 1, topologyBlocked("b1", holders, 0)) {
+		t.Errorf("b1 should wait for a1 without topology limit")
+	}
+	// The entry of the node itself does not block the waiters
+	if topologyBlocked("a0", holders, 1)(queue[0]) {
+		t.Errorf("a1 should not be blocked by the entry of the node checking the queue")
+	}
+}
+
+func TestDaemonSetLockDequeue(t *testing.T) {
+	ctx := context.Background()
+	queue := waitQueue{}.join("n1", "", time.Now().UTC())
+	queueBytes, err := json.Marshal(queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewClientset(&v1.DaemonSet{ObjectMeta: metav1.ObjectMeta{
+		Name:        "kured",
+		Namespace:   "kube-system",
+		Annotations: map[string]string{"weave.works/kured-node-lock-queue": string(queueBytes)},
+	}})
+
+	// kured restarted since n1 joined the queue
+	lock := New(client, "n1", "kube-system", "kured", "weave.works/kured-node-lock", 0, intstr.FromInt32(1), 0, WithQueue(time.Hour))
+	if err := lock.Dequeue(ctx); err != nil {
+		t.Fatalf("Dequeue() unexpected error: %v", err)
+	}
+	ds, err := client.AppsV1().DaemonSets("kube-system").Get(ctx, "kured", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := ds.Annotations["weave.works/kured-node-lock-queue"]; exists {
+		t.Errorf("n1 should have left the queue recorded on the ds, got %v", ds.Annotations)
+	}
+}
+
+func TestParseAndSetQueue(t *testing.T) {
+	annotation := "weave.works/kured-node-lock-queue"
+	annotations := map[string]string{}
+	queue := waitQueue{}.join("n1", "", time.Now().UTC())
+
+	if err := setQueue(annotations, annotation, queue); err != nil {
+		t.Fatalf("setQueue() unexpected error: %v", err)
+	}
+	read, err := parseQueue(annotations, annotation)
+	if err != nil || read.position("n1") != 1 {
+		t.Errorf("queue not read back: %v %v", read, err)
+	}
+
+	if err := setQueue(annotations, annotation, queue.leave("n1")); err != nil {
+		t.Fatalf("setQueue() unexpected error: %v", err)
+	}
+	if _, exists := annotations[annotation]; exists {
+		t.Errorf("empty queue should remove the annotation")
+	}
+}
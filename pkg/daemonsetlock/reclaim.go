@@ -0,0 +1,67 @@
+package daemonsetlock
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nodeGone reports whether the node recorded in the lock metadata no longer exists:
+// either it was deleted, or it was replaced by a new Node object with the same name.
+// Locks recorded before the node UID was tracked can only be reclaimed once the node is deleted.
+func nodeGone(metadata NodeMeta, node *corev1.Node, notFound bool) bool {
+	if notFound {
+		return true
+	}
+	return metadata.UID != "" && node != nil && node.UID != metadata.UID
+}
+
+// holderGone checks whether the node holding a lock entry was deleted or replaced,
+// in which case its entry can be reclaimed without waiting for its TTL.
+// Errors when looking up the node keep the entry, as the node might still exist.
+func (dsl *DaemonSetLock) holderGone(ctx context.Context, value LockAnnotationValue) bool {
+	if dsl.lookupNodeGone(ctx, value.NodeID, value.Metadata) {
+		log.Infof("Reclaiming lock held by node %s, which was deleted or replaced", value.NodeID)
+		return true
+	}
+	return false
+}
+
+// waiterGone checks whether a node waiting in the lock queue was deleted, in which
+// case it can be removed from the queue without waiting for it to become stale.
+// The node itself is never considered gone.
+func (dsl *DaemonSetLock) waiterGone(ctx context.Context, waiter Waiter) bool {
+	if waiter.NodeID == dsl.nodeID {
+		return false
+	}
+	if dsl.lookupNodeGone(ctx, waiter.NodeID, NodeMeta{}) {
+		log.Infof("Removing node %s from the lock queue, as it was deleted", waiter.NodeID)
+		return true
+	}
+	return false
+}
+
+// lookupNodeGone gets the node and reports whether it was deleted or replaced, see nodeGone.
+func (dsl *DaemonSetLock) lookupNodeGone(ctx context.Context, nodeID string, metadata NodeMeta) bool {
+	node, err := dsl.client.CoreV1().Nodes().Get(ctx, nodeID, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		log.Warnf("Error checking whether node %s still exists: %v", nodeID, err)
+		return false
+	}
+	return nodeGone(metadata, node, errors.IsNotFound(err))
+}
+
+// withoutGoneHolders removes the lock entries of other nodes which were deleted or replaced.
+func (dsl *DaemonSetLock) withoutGoneHolders(ctx context.Context, values []LockAnnotationValue) []LockAnnotationValue {
+	var kept []LockAnnotationValue
+	for _, value := range values {
+		if value.NodeID != dsl.nodeID && !value.expired() && dsl.holderGone(ctx, value) {
+			continue
+		}
+		kept = append(kept, value)
+	}
+	return kept
+}
@@ -0,0 +1,34 @@
+package daemonsetlock
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNodeGone(t *testing.T) {
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "n1", UID: "uid-1"}}
+
+	tests := []struct {
+		name     string
+		metadata NodeMeta
+		node     *corev1.Node
+		notFound bool
+		want     bool
+	}{
+		{name: "node_deleted", metadata: NodeMeta{UID: "uid-1"}, notFound: true, want: true},
+		{name: "node_deleted_without_recorded_uid", metadata: NodeMeta{}, notFound: true, want: true},
+		{name: "same_node", metadata: NodeMeta{UID: "uid-1"}, node: node, want: false},
+		{name: "node_replaced", metadata: NodeMeta{UID: "uid-0"}, node: node, want: true},
+		{name: "no_recorded_uid", metadata: NodeMeta{}, node: node, want: false},
+	}
+
+	for _, tst := range tests {
+		t.Run(tst.name, func(t *testing.T) {
+			if got := nodeGone(tst.metadata, tst.node, tst.notFound); got != tst.want {
+				t.Errorf("nodeGone() = %v, want %v", got, tst.want)
+			}
+		})
+	}
+}
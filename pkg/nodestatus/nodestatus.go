@@ -0,0 +1,152 @@
+// Package nodestatus mirrors the result of the reboot checks onto the Node object,
+// as a node condition and a label, so that pending reboots are visible through the
+// Kubernetes API without scraping kured's metrics.
+package nodestatus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kubereboot/kured/pkg/checkers"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConditionType is the type of the node condition published by kured.
+const ConditionType v1.NodeConditionType = "KuredRebootRequired"
+
+// Reasons of the published node condition.
+const (
+	// ReasonRebootRequired is used when the reboot checker requires a reboot
+	ReasonRebootRequired = "RebootRequired"
+	// ReasonRebootNotRequired is used when the reboot checker does not require a reboot
+	ReasonRebootNotRequired = "RebootNotRequired"
+	// ReasonCheckFailed is used when the reboot check failed, the condition status is then Unknown
+	ReasonCheckFailed = "CheckFailed"
+)
+
+// Publisher publishes the reboot check results on a node, as the KuredRebootRequired
+// condition when Condition is set, and as a label when Label is not empty.
+type Publisher struct {
+	client    *kubernetes.Clientset
+	nodeID    string
+	condition bool
+	label     string
+}
+
+// New provides a new publisher. Nothing is published when condition is false and label is empty.
+func New(client *kubernetes.Clientset, nodeID string, condition bool, label string) *Publisher {
+	return &Publisher{
+		client:    client,
+		nodeID:    nodeID,
+		condition: condition,
+		label:     label,
+	}
+}
+
+// Enabled reports whether the publisher publishes anything.
+func (p *Publisher) Enabled() bool {
+	return p.condition || p.label != ""
+}
+
+// Publish updates the node condition and label according to the result of the reboot check,
+// or to its error. The message describes the reboot reason in the condition. The node is only
+// patched when they change. A failed check sets the condition to Unknown, and leaves the label as is.
+func (p *Publisher) Publish(ctx context.Context, result checkers.Result, checkErr error, message string) error {
+	if !p.Enabled() {
+		return nil
+	}
+	node, err := p.client.CoreV1().Nodes().Get(ctx, p.nodeID, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error retrieving node object via k8s API: %w", err)
+	}
+
+	if p.condition {
+		condition, changed := desiredCondition(findCondition(node.Status.Conditions, ConditionType), result, checkErr, message, time.Now())
+		if changed {
+			log.Infof("Setting node %s condition %s=%s: %s", p.nodeID, condition.Type, condition.Status, condition.Reason)
+			patch, err := json.Marshal(map[string]interface{}{
+				"status": map[string]interface{}{
+					"conditions": []v1.NodeCondition{condition},
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("error marshalling node condition into JSON: %w", err)
+			}
+			_, err = p.client.CoreV1().Nodes().PatchStatus(ctx, p.nodeID, patch)
+			if err != nil {
+				return fmt.Errorf("error setting node condition %s via k8s API: %w", ConditionType, err)
+			}
+		}
+	}
+
+	if p.label != "" && checkErr == nil {
+		_, labelled := node.Labels[p.label]
+		if labelled != result.Required {
+			// A null value removes the label
+			var value *string
+			if result.Required {
+				labelValue := "true"
+				value = &labelValue
+			}
+			log.Infof("Setting node %s label %s: %v", p.nodeID, p.label, result.Required)
+			patch, err := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]*string{p.label: value},
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("error marshalling node label into JSON: %w", err)
+			}
+			_, err = p.client.CoreV1().Nodes().Patch(ctx, p.nodeID, types.MergePatchType, patch, metav1.PatchOptions{})
+			if err != nil {
+				return fmt.Errorf("error setting node label %s via k8s API: %w", p.label, err)
+			}
+		}
+	}
+	return nil
+}
+
+// findCondition returns the condition of the given type, or nil when there is none.
+func findCondition(conditions []v1.NodeCondition, conditionType v1.NodeConditionType) *v1.NodeCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// desiredCondition computes the condition reflecting the reboot check, and whether it differs
+// from the current one. The transition time is only moved when the status changes.
+func desiredCondition(current *v1.NodeCondition, result checkers.Result, checkErr error, message string, now time.Time) (v1.NodeCondition, bool) {
+	condition := v1.NodeCondition{
+		Type:              ConditionType,
+		Status:            v1.ConditionFalse,
+		Reason:            ReasonRebootNotRequired,
+		Message:           "kured does not require a reboot",
+		LastHeartbeatTime: metav1.NewTime(now),
+	}
+	switch {
+	case checkErr != nil:
+		condition.Status = v1.ConditionUnknown
+		condition.Reason = ReasonCheckFailed
+		condition.Message = checkErr.Error()
+	case result.Required:
+		condition.Status = v1.ConditionTrue
+		condition.Reason = ReasonRebootRequired
+		condition.Message = message
+	}
+
+	if current == nil || current.Status != condition.Status {
+		condition.LastTransitionTime = condition.LastHeartbeatTime
+		return condition, true
+	}
+	condition.LastTransitionTime = current.LastTransitionTime
+	return condition, current.Reason != condition.Reason || current.Message != condition.Message
+}
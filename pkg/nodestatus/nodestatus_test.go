@@ -0,0 +1,81 @@
+package nodestatus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kubereboot/kured/pkg/checkers"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDesiredCondition(t *testing.T) {
+	before := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := before.Add(time.Hour)
+	notRequired := &v1.NodeCondition{
+		Type:               ConditionType,
+		Status:             v1.ConditionFalse,
+		Reason:             ReasonRebootNotRequired,
+		Message:            "kured does not require a reboot",
+		LastTransitionTime: metav1.NewTime(before),
+	}
+
+	tests := []struct {
+		name           string
+		current        *v1.NodeCondition
+		result         checkers.Result
+		checkErr       error
+		wantStatus     v1.ConditionStatus
+		wantReason     string
+		wantTransition time.Time
+		wantChanged    bool
+	}{
+		{
+			name:           "new condition",
+			result:         checkers.Result{},
+			wantStatus:     v1.ConditionFalse,
+			wantReason:     ReasonRebootNotRequired,
+			wantTransition: now,
+			wantChanged:    true,
+		},
+		{
+			name:           "unchanged condition",
+			current:        notRequired,
+			result:         checkers.Result{},
+			wantStatus:     v1.ConditionFalse,
+			wantReason:     ReasonRebootNotRequired,
+			wantTransition: before,
+			wantChanged:    false,
+		},
+		{
+			name:           "reboot required",
+			current:        notRequired,
+			result:         checkers.Result{Required: true, Reason: "sentinel file exists"},
+			wantStatus:     v1.ConditionTrue,
+			wantReason:     ReasonRebootRequired,
+			wantTransition: now,
+			wantChanged:    true,
+		},
+		{
+			name:           "check failed",
+			current:        notRequired,
+			checkErr:       errors.New("sentinel command timed out"),
+			wantStatus:     v1.ConditionUnknown,
+			wantReason:     ReasonCheckFailed,
+			wantTransition: now,
+			wantChanged:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := desiredCondition(tt.current, tt.result, tt.checkErr, tt.result.Reason, now)
+			if got.Status != tt.wantStatus || got.Reason != tt.wantReason || changed != tt.wantChanged {
+				t.Errorf("desiredCondition() = %s, %s, %v, want %s, %s, %v", got.Status, got.Reason, changed, tt.wantStatus, tt.wantReason, tt.wantChanged)
+			}
+			if !got.LastTransitionTime.Time.Equal(tt.wantTransition) {
+				t.Errorf("desiredCondition() transition time = %v, want %v", got.LastTransitionTime, tt.wantTransition)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package reboot
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultSysrqTriggerPath is the file triggering the magic SysRq key functions of the kernel.
+// Writing to it works whatever the kernel.sysrq setting, but requires a privileged container.
+const DefaultSysrqTriggerPath = "/proc/sysrq-trigger"
+
+// sysrqSyncDelay leaves time to the emergency sync and remount, which run asynchronously.
+const sysrqSyncDelay = 2 * time.Second
+
+// SysrqRebooter forces an immediate reboot through the magic SysRq key, without shutting
+// down the services: it is a last resort when the other reboot methods do not work.
+// The filesystems are synced and remounted read-only first, to limit data loss.
+type SysrqRebooter struct {
+	TriggerPath string
+	SyncDelay   time.Duration
+}
+
+// Reboot syncs the filesystems (s), remounts them read-only (u), then reboots (b).
+func (c SysrqRebooter) Reboot() error {
+	for _, function := range []string{"s", "u"} {
+		if err := c.trigger(function); err != nil {
+			return err
+		}
+		time.Sleep(c.SyncDelay)
+	}
+	return c.trigger("b")
+}
+
+func (c SysrqRebooter) trigger(function string) error {
+	if err := os.WriteFile(c.TriggerPath, []byte(function), 0o200); err != nil {
+		return fmt.Errorf("error triggering sysrq %s: %w", function, err)
+	}
+	return nil
+}
+
+// NewSysrqRebooter is the constructor of the SysrqRebooter, using the sysrq trigger of the kernel.
+func NewSysrqRebooter() (*SysrqRebooter, error) {
+	return &SysrqRebooter{TriggerPath: DefaultSysrqTriggerPath, SyncDelay: sysrqSyncDelay}, nil
+}
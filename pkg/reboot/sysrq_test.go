@@ -0,0 +1,27 @@
+package reboot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSysrqRebooter(t *testing.T) {
+	trigger := filepath.Join(t.TempDir(), "sysrq-trigger")
+	if err := os.WriteFile(trigger, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The trigger is not truncated by the kernel: the last function is left in the file
+	rebooter := SysrqRebooter{TriggerPath: trigger}
+	if err := rebooter.Reboot(); err != nil {
+		t.Fatalf("Reboot() unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(trigger); string(got) != "b" {
+		t.Errorf("Reboot() last triggered %q, want b", got)
+	}
+
+	rebooter.TriggerPath = filepath.Join(t.TempDir(), "missing", "sysrq-trigger")
+	if err := rebooter.Reboot(); err == nil {
+		t.Errorf("Reboot() expected an error for a missing trigger")
+	}
+}